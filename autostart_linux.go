@@ -0,0 +1,25 @@
+package main
+
+// systemdLauncher starts the tray app with the graphical session through a
+// systemd user unit.
+type systemdLauncher struct {
+	exe     string
+	appName string
+}
+
+func newLoginLauncher(exe, appName string) loginLauncher {
+	return systemdLauncher{exe: exe, appName: appName}
+}
+
+func (l systemdLauncher) IsEnabled() bool {
+	return unitEnabled(trayUnitName)
+}
+
+func (l systemdLauncher) Enable() error {
+	return installUnits([]systemdUnit{trayUnit(l.exe, l.appName)}, trayUnitName, false)
+}
+
+// Disable leaves the running app alone, it only stops it starting at login.
+func (l systemdLauncher) Disable() error {
+	return uninstallUnits(false, trayUnitName)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "github.com/jannson/go-autostart"
+
+func newLoginLauncher(exe, appName string) loginLauncher {
+	return &autostart.App{
+		Name:        appNamespace,
+		DisplayName: appName,
+		Exec:        []string{exe},
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+
+	"fyne.io/fyne/v2"
+)
+
+const baselineFileName string = "config.yaml"
+
+// getBaselineFile returns where administrators put the team baseline on osName.
+func getBaselineFile(osName string) string {
+	switch osName {
+	case "darwin":
+		return path.Join("/Library", "Application Support", appNameDefault, baselineFileName)
+	case "windows":
+		root := os.Getenv("ProgramData")
+		if root == "" {
+			root = "C:/ProgramData"
+		}
+		return path.Join(root, appNameDefault, baselineFileName)
+	default:
+		return path.Join("/etc", "deskclean", baselineFileName)
+	}
+}
+
+// loadBaseline reads the team baseline from file into read-only preferences.
+// It returns nil when there is no baseline, and logs and ignores one that
+// cannot be used so a broken file never keeps sweeps from running.
+func loadBaseline(file string) *filePreferences {
+	if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	doc, err := readConfig(file)
+	if err == nil {
+		base := &filePreferences{values: map[string]any{}}
+		if err = importConfig(base, doc); err == nil {
+			slog.Info("Loaded team baseline.", slog.String("file", file), slog.Int("settingCount", len(doc.Settings)))
+			return base
+		}
+	}
+	slog.Error("Unable to load team baseline.", slog.Any("error", err), slog.String("file", file))
+	return nil
+}
+
+// layeredPreferences reads settings the user has not set from the team
+// baseline. Changes are always made to the user's own preferences.
+type layeredPreferences struct {
+	fyne.Preferences
+	base *filePreferences
+}
+
+var _ fyne.Preferences = (*layeredPreferences)(nil)
+
+// layerBaseline puts the team baseline, if there is one, under pref.
+func layerBaseline(pref fyne.Preferences, file string) fyne.Preferences {
+	base := loadBaseline(file)
+	if base == nil {
+		return pref
+	}
+	return &layeredPreferences{Preferences: pref, base: base}
+}
+
+func (p *layeredPreferences) Bool(key string) bool {
+	return p.BoolWithFallback(key, false)
+}
+
+func (p *layeredPreferences) BoolWithFallback(key string, fallback bool) bool {
+	return p.Preferences.BoolWithFallback(key, p.base.BoolWithFallback(key, fallback))
+}
+
+func (p *layeredPreferences) BoolList(key string) []bool {
+	return p.BoolListWithFallback(key, []bool{})
+}
+
+func (p *layeredPreferences) BoolListWithFallback(key string, fallback []bool) []bool {
+	return p.Preferences.BoolListWithFallback(key, p.base.BoolListWithFallback(key, fallback))
+}
+
+func (p *layeredPreferences) Float(key string) float64 {
+	return p.FloatWithFallback(key, 0)
+}
+
+func (p *layeredPreferences) FloatWithFallback(key string, fallback float64) float64 {
+	return p.Preferences.FloatWithFallback(key, p.base.FloatWithFallback(key, fallback))
+}
+
+func (p *layeredPreferences) FloatList(key string) []float64 {
+	return p.FloatListWithFallback(key, []float64{})
+}
+
+func (p *layeredPreferences) FloatListWithFallback(key string, fallback []float64) []float64 {
+	return p.Preferences.FloatListWithFallback(key, p.base.FloatListWithFallback(key, fallback))
+}
+
+func (p *layeredPreferences) Int(key string) int {
+	return p.IntWithFallback(key, 0)
+}
+
+func (p *layeredPreferences) IntWithFallback(key string, fallback int) int {
+	return p.Preferences.IntWithFallback(key, p.base.IntWithFallback(key, fallback))
+}
+
+func (p *layeredPreferences) IntList(key string) []int {
+	return p.IntListWithFallback(key, []int{})
+}
+
+func (p *layeredPreferences) IntListWithFallback(key string, fallback []int) []int {
+	return p.Preferences.IntListWithFallback(key, p.base.IntListWithFallback(key, fallback))
+}
+
+func (p *layeredPreferences) String(key string) string {
+	return p.StringWithFallback(key, "")
+}
+
+func (p *layeredPreferences) StringWithFallback(key, fallback string) string {
+	return p.Preferences.StringWithFallback(key, p.base.StringWithFallback(key, fallback))
+}
+
+func (p *layeredPreferences) StringList(key string) []string {
+	return p.StringListWithFallback(key, []string{})
+}
+
+func (p *layeredPreferences) StringListWithFallback(key string, fallback []string) []string {
+	return p.Preferences.StringListWithFallback(key, p.base.StringListWithFallback(key, fallback))
+}
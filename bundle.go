@@ -0,0 +1,439 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type bundleFormat string
+
+const (
+	bundleZip    bundleFormat = "zip"
+	bundleTarGz  bundleFormat = "tar.gz"
+	bundleTarZst bundleFormat = "tar.zst"
+
+	bundleIndexExt string = ".index.json"
+)
+
+var allowedBundleFormats = []string{string(bundleZip), string(bundleTarGz), string(bundleTarZst)}
+
+// numberedName matches the " (n)" suffix freeName adds to a taken name.
+var numberedName = regexp.MustCompile(` \(\d+\)$`)
+
+// bundleEntry describes a single file, folder or symlink inside a bundle.
+type bundleEntry struct {
+	Name    string      `json:"name"`
+	Size    int64       `json:"size"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	Link    string      `json:"link,omitempty"`
+	SHA256  string      `json:"sha256,omitempty"`
+}
+
+// bundleIndex lists the contents of a bundle so it can be searched and
+// restored from without unpacking it. It is kept next to the bundle.
+type bundleIndex struct {
+	Bundle    string        `json:"bundle"`
+	Folder    string        `json:"folder"`
+	Format    bundleFormat  `json:"format"`
+	CreatedAt time.Time     `json:"createdAt"`
+	SHA256    string        `json:"sha256"`
+	Entries   []bundleEntry `json:"entries"`
+}
+
+// bundleWriter adds entries to a bundle of one of the formats.
+type bundleWriter interface {
+	add(e bundleEntry, r io.Reader) error
+	Close() error
+}
+
+// bundleFormatOf returns the format of a bundle file from its extension, along
+// with the name of the folder it was made from.
+func bundleFormatOf(name string) (bundleFormat, string, bool) {
+	for _, f := range allowedBundleFormats {
+		if base, found := strings.CutSuffix(name, "."+f); found {
+			return bundleFormat(f), numberedName.ReplaceAllString(base, ""), true
+		}
+	}
+	return "", "", false
+}
+
+// bundleFolder packs folder into the bundle file, checks that every entry
+// reads back intact and only then removes the folder.
+func bundleFolder(folder, file string) (bundleIndex, error) {
+	format, _, ok := bundleFormatOf(path.Base(file))
+	if !ok {
+		return bundleIndex{}, fmt.Errorf("unknown bundle format %q", file)
+	}
+	idx := bundleIndex{Bundle: file, Folder: folder, Format: format, CreatedAt: time.Now(), Entries: []bundleEntry{}}
+
+	tmp := path.Join(path.Dir(file), partialPrefix+path.Base(file))
+	if err := writeBundle(folder, tmp, &idx); err != nil {
+		os.Remove(tmp)
+		return idx, err
+	}
+	if err := verifyBundle(tmp, idx); err != nil {
+		os.Remove(tmp)
+		return idx, fmt.Errorf("verify %s: %w", file, err)
+	}
+	sum, err := hashFile(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return idx, err
+	}
+	idx.SHA256 = hex.EncodeToString(sum)
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return idx, err
+	}
+	if err := saveBundleIndex(idx); err != nil {
+		return idx, err
+	}
+	return idx, os.RemoveAll(folder)
+}
+
+func writeBundle(folder, file string, idx *bundleIndex) error {
+	out, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var bw bundleWriter
+	switch idx.Format {
+	case bundleZip:
+		bw = zipBundleWriter{zip.NewWriter(out)}
+	case bundleTarGz:
+		bw = newTarBundleWriter(gzip.NewWriter(out))
+	case bundleTarZst:
+		zw, err := zstd.NewWriter(out)
+		if err != nil {
+			return err
+		}
+		bw = newTarBundleWriter(zw)
+	}
+
+	err = filepath.WalkDir(folder, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(folder, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := bundleEntry{Name: filepath.ToSlash(rel), Mode: info.Mode(), ModTime: info.ModTime()}
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if e.Link, err = os.Readlink(p); err != nil {
+				return err
+			}
+			err = bw.add(e, nil)
+		case info.Mode().IsRegular():
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			h := sha256.New()
+			e.Size = info.Size()
+			if err := bw.add(e, io.TeeReader(f, h)); err != nil {
+				return err
+			}
+			e.SHA256 = hex.EncodeToString(h.Sum(nil))
+		case info.IsDir():
+			err = bw.add(e, nil)
+		default:
+			// Sockets, devices and pipes have no place in an archive
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		idx.Entries = append(idx.Entries, e)
+		return nil
+	})
+	if err != nil {
+		bw.Close()
+		return err
+	}
+	if err := bw.Close(); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// verifyBundle reads every entry of the bundle back and compares it with the index.
+func verifyBundle(file string, idx bundleIndex) error {
+	want := map[string]bundleEntry{}
+	for _, e := range idx.Entries {
+		want[e.Name] = e
+	}
+	seen := 0
+	err := readBundle(file, idx.Format, func(e bundleEntry, r io.Reader) error {
+		w, ok := want[e.Name]
+		if !ok {
+			return fmt.Errorf("unexpected entry %s", e.Name)
+		}
+		seen++
+		if !w.Mode.IsRegular() {
+			return nil
+		}
+		h := sha256.New()
+		n, err := io.Copy(h, r)
+		if err != nil {
+			return err
+		}
+		if n != w.Size || hex.EncodeToString(h.Sum(nil)) != w.SHA256 {
+			return fmt.Errorf("%s does not match the original", e.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if seen != len(want) {
+		return fmt.Errorf("bundle has %d entries, expected %d", seen, len(want))
+	}
+	return nil
+}
+
+// readBundle calls fn with every entry of the bundle in order. The reader is
+// only valid for regular files and until fn returns.
+func readBundle(file string, format bundleFormat, fn func(e bundleEntry, r io.Reader) error) error {
+	if format == bundleZip {
+		zr, err := zip.OpenReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			e := bundleEntry{Name: strings.TrimSuffix(f.Name, "/"), Size: int64(f.UncompressedSize64), Mode: f.Mode(), ModTime: f.Modified}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			if e.Mode&fs.ModeSymlink != 0 {
+				// Zip stores the link target as the content
+				link, err := io.ReadAll(rc)
+				if err != nil {
+					rc.Close()
+					return err
+				}
+				e.Link = string(link)
+			}
+			err = fn(e, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var r io.Reader
+	switch format {
+	case bundleTarGz:
+		gr, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	case bundleTarZst:
+		zr, err := zstd.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return fmt.Errorf("unknown bundle format %q", format)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e := bundleEntry{Name: strings.TrimSuffix(hdr.Name, "/"), Size: hdr.Size, Mode: hdr.FileInfo().Mode(), ModTime: hdr.ModTime, Link: hdr.Linkname}
+		if err := fn(e, tr); err != nil {
+			return err
+		}
+	}
+}
+
+type zipBundleWriter struct {
+	zw *zip.Writer
+}
+
+func (w zipBundleWriter) add(e bundleEntry, r io.Reader) error {
+	hdr := &zip.FileHeader{Name: e.Name, Modified: e.ModTime, Method: zip.Deflate}
+	hdr.SetMode(e.Mode)
+	switch {
+	case e.Mode.IsDir():
+		hdr.Name += "/"
+		hdr.Method = zip.Store
+	case e.Link != "":
+		r = strings.NewReader(e.Link)
+	}
+	fw, err := w.zw.CreateHeader(hdr)
+	if err != nil || r == nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (w zipBundleWriter) Close() error {
+	return w.zw.Close()
+}
+
+type tarBundleWriter struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser
+}
+
+func newTarBundleWriter(compressor io.WriteCloser) tarBundleWriter {
+	return tarBundleWriter{tw: tar.NewWriter(compressor), compressor: compressor}
+}
+
+func (w tarBundleWriter) add(e bundleEntry, r io.Reader) error {
+	hdr := &tar.Header{Name: e.Name, Mode: int64(e.Mode.Perm()), ModTime: e.ModTime, Format: tar.FormatPAX}
+	switch {
+	case e.Mode.IsDir():
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case e.Link != "":
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = e.Link
+	default:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = e.Size
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil || r == nil {
+		return err
+	}
+	_, err := io.Copy(w.tw, r)
+	return err
+}
+
+func (w tarBundleWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		w.compressor.Close()
+		return err
+	}
+	return w.compressor.Close()
+}
+
+func saveBundleIndex(idx bundleIndex) error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := idx.Bundle + bundleIndexExt
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func loadBundleIndex(bundle string) (bundleIndex, error) {
+	var idx bundleIndex
+	data, err := os.ReadFile(bundle + bundleIndexExt)
+	if err != nil {
+		return idx, err
+	}
+	err = json.Unmarshal(data, &idx)
+	return idx, err
+}
+
+// extractBundleEntry writes entry, and everything inside it when it is a
+// folder, out of the bundle to dst.
+func extractBundleEntry(file, entry, dst string) error {
+	format, _, ok := bundleFormatOf(path.Base(file))
+	if !ok {
+		return fmt.Errorf("unknown bundle format %q", file)
+	}
+	found := false
+	err := readBundle(file, format, func(e bundleEntry, r io.Reader) error {
+		if e.Name != entry && !strings.HasPrefix(e.Name, entry+"/") {
+			return nil
+		}
+		found = true
+		target := dst + strings.TrimPrefix(e.Name, entry)
+		switch {
+		case e.Mode.IsDir():
+			return os.MkdirAll(target, e.Mode.Perm()|0700)
+		case e.Link != "":
+			if err := os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+				return err
+			}
+			return os.Symlink(e.Link, target)
+		case e.Mode.IsRegular():
+			return extractBundleFile(target, e, r)
+		}
+		return nil
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("%s is not in %s", entry, file)
+	}
+	return err
+}
+
+// extractBundleFile writes a single file under a hidden name and renames it
+// into place once it is complete.
+func extractBundleFile(target string, e bundleEntry, r io.Reader) error {
+	if err := os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := path.Join(path.Dir(target), partialPrefix+path.Base(target))
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, e.Mode.Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, e.ModTime, e.ModTime)
+	}
+	if err == nil {
+		err = os.Rename(tmp, target)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestBundleFormatOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		format bundleFormat
+		folder string
+		ok     bool
+	}{
+		{"2026-09-Archive.zip", bundleZip, "2026-09-Archive", true},
+		{"2026-09-Archive.tar.gz", bundleTarGz, "2026-09-Archive", true},
+		{"2026-09-Archive (2).tar.zst", bundleTarZst, "2026-09-Archive", true},
+		{"2026-09-Archive.tar", "", "", false},
+		{"notes.txt", "", "", false},
+	}
+	for _, tt := range tests {
+		format, folder, ok := bundleFormatOf(tt.name)
+		if format != tt.format || folder != tt.folder || ok != tt.ok {
+			t.Errorf("bundleFormatOf(%q) = %q, %q, %v, want %q, %q, %v", tt.name, format, folder, ok, tt.format, tt.folder, tt.ok)
+		}
+	}
+}
+
+func TestBundleFolder(t *testing.T) {
+	stamp := time.Date(2026, time.September, 3, 10, 0, 0, 0, time.UTC)
+	for _, format := range []bundleFormat{bundleZip, bundleTarGz, bundleTarZst} {
+		dir := t.TempDir()
+		folder := path.Join(dir, "2026-09-Archive")
+		writeTree(t, folder, map[string]string{"a.txt": "alpha", "project/notes.md": "# notes", "project/empty.txt": ""})
+		if err := os.Chtimes(path.Join(folder, "a.txt"), stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("a.txt", path.Join(folder, "link")); err != nil {
+			t.Fatal(err)
+		}
+
+		file := folder + "." + string(format)
+		idx, err := bundleFolder(folder, file)
+		if err != nil {
+			t.Fatalf("%s: bundleFolder: %v", format, err)
+		}
+		if _, err := os.Lstat(folder); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: folder still exists after bundling: %v", format, err)
+		}
+		if len(idx.Entries) != 5 || idx.SHA256 == "" {
+			t.Errorf("%s: index has %d entries and sum %q, want 5 and a sum", format, len(idx.Entries), idx.SHA256)
+		}
+		saved, err := loadBundleIndex(file)
+		if err != nil || saved.Bundle != file || saved.Folder != folder || len(saved.Entries) != len(idx.Entries) {
+			t.Errorf("%s: saved index = %+v, %v, want the returned one", format, saved, err)
+		}
+
+		out := path.Join(dir, "restored")
+		if err := extractBundleEntry(file, "a.txt", path.Join(out, "a.txt")); err != nil {
+			t.Fatalf("%s: extract a.txt: %v", format, err)
+		}
+		if info, err := os.Stat(path.Join(out, "a.txt")); err != nil || !info.ModTime().Equal(stamp) {
+			t.Errorf("%s: a.txt = %v, %v, want its time %v kept", format, info, err, stamp)
+		}
+		if err := extractBundleEntry(file, "project", path.Join(out, "project")); err != nil {
+			t.Fatalf("%s: extract project: %v", format, err)
+		}
+		for name, want := range map[string]string{"a.txt": "alpha", "project/notes.md": "# notes", "project/empty.txt": ""} {
+			if data, err := os.ReadFile(path.Join(out, name)); err != nil || string(data) != want {
+				t.Errorf("%s: %s = %q, %v, want %q", format, name, data, err, want)
+			}
+		}
+		if err := extractBundleEntry(file, "link", path.Join(out, "link")); err != nil {
+			t.Fatalf("%s: extract link: %v", format, err)
+		}
+		if target, err := os.Readlink(path.Join(out, "link")); err != nil || target != "a.txt" {
+			t.Errorf("%s: link = %q, %v, want a link to a.txt", format, target, err)
+		}
+		// A prefix of a name is not a folder
+		if err := extractBundleEntry(file, "proj", path.Join(out, "proj")); err == nil {
+			t.Errorf("%s: extracting a missing entry should fail", format)
+		}
+	}
+}
+
+func TestBundleFolderRefusesUnknownFormat(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"folder/a.txt": "a"})
+	if _, err := bundleFolder(path.Join(dir, "folder"), path.Join(dir, "folder.rar")); err == nil {
+		t.Error("bundleFolder to a .rar should fail")
+	}
+	if _, err := os.Stat(path.Join(dir, "folder", "a.txt")); err != nil {
+		t.Errorf("folder should be left alone: %v", err)
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+const catalogFileName string = "catalog.json"
+
+// catalogItem is a single file or folder that a sweep moved into the archive.
+// Items packed into a bundle keep the bundle as Archived and their name inside
+// it as Entry.
+type catalogItem struct {
+	ID         string     `json:"id"`
+	Original   string     `json:"original,omitempty"`
+	Archived   string     `json:"archived"`
+	Entry      string     `json:"entry,omitempty"`
+	Size       int64      `json:"size"`
+	ModTime    time.Time  `json:"modTime"`
+	IsDir      bool       `json:"isDir,omitempty"`
+	SHA256     string     `json:"sha256,omitempty"`
+	SweptAt    time.Time  `json:"sweptAt"`
+	ManifestID string     `json:"manifestId,omitempty"`
+	Profile    string     `json:"profile,omitempty"`
+	RestoredTo string     `json:"restoredTo,omitempty"`
+	RestoredAt *time.Time `json:"restoredAt,omitempty"`
+}
+
+// location is where the item can be found now, including its place in a bundle.
+func (i catalogItem) location() string {
+	if i.Entry != "" {
+		return i.Archived + ":" + i.Entry
+	}
+	return i.Archived
+}
+
+// under reports whether the item is p or lives inside it.
+func (i catalogItem) under(p string) bool {
+	return i.Archived == p || strings.HasPrefix(i.Archived, p+"/")
+}
+
+func (i catalogItem) String() string {
+	swept := ""
+	if !i.SweptAt.IsZero() {
+		swept = i.SweptAt.Format("2006-01-02 15:04")
+	}
+	switch {
+	case i.RestoredAt != nil:
+		return fmt.Sprintf("%s  %s  (restored to %s)", swept, i.location(), i.RestoredTo)
+	case i.Original == "":
+		return fmt.Sprintf("%s  %s", swept, i.location())
+	}
+	return fmt.Sprintf("%s  %s  (from %s)", swept, i.location(), i.Original)
+}
+
+// sweepCatalog is the searchable record of everything swept into the archive.
+type sweepCatalog struct {
+	Items  []catalogItem `json:"items"`
+	NextID int           `json:"nextId"`
+
+	file  string
+	index map[string]int
+}
+
+func getCatalogFile(appName string) string {
+	return path.Join(getDataDir(appName), catalogFileName)
+}
+
+// openCatalog reads the catalog of the app. When there is none yet it is built
+// from what is already in the archive.
+func openCatalog(pref fyne.Preferences, appName string) (*sweepCatalog, error) {
+	c := &sweepCatalog{file: getCatalogFile(appName), Items: []catalogItem{}}
+	data, err := os.ReadFile(c.file)
+	if err == nil {
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, err
+		}
+		c.reindex()
+		return c, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	c.reindex()
+	archiveRoot := getArchiveRoot(pref)
+	if err := c.seed(archiveRoot, getManifestDir(appName)); err != nil {
+		return nil, err
+	}
+	slog.Info("Built catalog of the archive.", slog.Int("itemCount", len(c.Items)))
+	return c, c.save()
+}
+
+// updateCatalog runs fn on the catalog and saves it. Problems with the catalog
+// are logged and never keep fn from running.
+func updateCatalog(pref fyne.Preferences, appName string, fn func(c *sweepCatalog)) {
+	c, err := openCatalog(pref, appName)
+	if err != nil {
+		slog.Warn("Unable to open catalog.", slog.Any("error", err))
+		c = &sweepCatalog{Items: []catalogItem{}}
+		c.reindex()
+		fn(c)
+		return
+	}
+	fn(c)
+	if err := c.save(); err != nil {
+		slog.Warn("Unable to save catalog.", slog.Any("error", err))
+	}
+}
+
+func (c *sweepCatalog) save() error {
+	if err := os.MkdirAll(path.Dir(c.file), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := c.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.file)
+}
+
+func (c *sweepCatalog) reindex() {
+	c.index = map[string]int{}
+	for i, item := range c.Items {
+		if item.ID == "" {
+			c.Items[i].ID = c.newID()
+		}
+		c.index[item.location()] = i
+	}
+}
+
+func (c *sweepCatalog) newID() string {
+	c.NextID++
+	return strconv.Itoa(c.NextID)
+}
+
+// add catalogs the item, replacing any earlier record of the same location.
+func (c *sweepCatalog) add(item catalogItem) {
+	if i, ok := c.index[item.location()]; ok {
+		item.ID = c.Items[i].ID
+		c.Items[i] = item
+		return
+	}
+	item.ID = c.newID()
+	c.index[item.location()] = len(c.Items)
+	c.Items = append(c.Items, item)
+}
+
+// addSweep catalogs every item the plan moved, along with the contents of any
+// folders it moved.
+func (c *sweepCatalog) addSweep(plan sweepPlan, m sweepManifest) {
+	for _, pm := range plan {
+		if pm.Action != actionMove || pm.Error != "" {
+			continue
+		}
+		err := filepath.WalkDir(pm.Destination, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			p = filepath.ToSlash(p)
+			item := catalogItem{
+				Original:   pm.Source + strings.TrimPrefix(p, pm.Destination),
+				Archived:   p,
+				Size:       info.Size(),
+				ModTime:    info.ModTime(),
+				IsDir:      d.IsDir(),
+				SweptAt:    m.SweptAt,
+				ManifestID: m.ID,
+				Profile:    m.Profile,
+			}
+			if d.Type().IsRegular() {
+				if sum, err := hashFile(p); err == nil {
+					item.SHA256 = hex.EncodeToString(sum)
+				}
+			}
+			c.add(item)
+			return nil
+		})
+		if err != nil {
+			slog.Warn("Unable to catalog swept item.", slog.Any("error", err), slog.String("file", pm.Destination))
+		}
+	}
+}
+
+// seed catalogs what is already in the archive. The original location and
+// sweep time come from the manifests of sweeps that were not undone.
+func (c *sweepCatalog) seed(archiveRoot, manifestDir string) error {
+	manifests, err := listManifests(manifestDir)
+	if err != nil {
+		return err
+	}
+	origins := map[string]catalogItem{}
+	for _, m := range manifests {
+		if m.Kind != "" || m.UndoneAt != nil {
+			continue
+		}
+		for _, mv := range m.Moves {
+			origins[mv.Archived] = catalogItem{Original: mv.Original, SweptAt: m.SweptAt, ManifestID: m.ID, Profile: m.Profile}
+		}
+	}
+	originOf := func(p string) (catalogItem, bool) {
+		for q := p; q != archiveRoot && q != "/" && q != "."; q = path.Dir(q) {
+			if o, ok := origins[q]; ok {
+				o.Original += strings.TrimPrefix(p, q)
+				return o, true
+			}
+		}
+		return catalogItem{}, false
+	}
+
+	err = filepath.WalkDir(archiveRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		p = filepath.ToSlash(p)
+		name := d.Name()
+		switch {
+		case p == archiveRoot:
+			return nil
+		case strings.HasPrefix(name, partialPrefix) && d.IsDir():
+			return fs.SkipDir
+		case strings.HasPrefix(name, partialPrefix), strings.HasSuffix(name, bundleIndexExt):
+			return nil
+		}
+		if _, _, isBundle := bundleFormatOf(name); isBundle && !d.IsDir() {
+			idx, err := loadBundleIndex(p)
+			if err != nil {
+				slog.Warn("Unable to read bundle index.", slog.Any("error", err), slog.String("file", p))
+				return nil
+			}
+			for _, e := range idx.Entries {
+				item, _ := originOf(path.Join(idx.Folder, e.Name))
+				item.Archived, item.Entry = p, e.Name
+				item.Size, item.ModTime, item.IsDir, item.SHA256 = e.Size, e.ModTime, e.Mode.IsDir(), e.SHA256
+				if item.SweptAt.IsZero() {
+					item.SweptAt = idx.CreatedAt
+				}
+				c.add(item)
+			}
+			return nil
+		}
+
+		item, ok := originOf(p)
+		// Dated folders and rule folders are made by sweeps, not swept themselves
+		if !ok && d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		item.Archived = p
+		item.Size, item.ModTime, item.IsDir = info.Size(), info.ModTime(), d.IsDir()
+		c.add(item)
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// relocate follows items moved from one place in the archive to another.
+func (c *sweepCatalog) relocate(from, to string) {
+	for i, item := range c.Items {
+		if item.under(from) {
+			c.Items[i].Archived = to + strings.TrimPrefix(item.Archived, from)
+		}
+	}
+	c.reindex()
+}
+
+// bundle follows the items of folder into the bundle it was packed into.
+func (c *sweepCatalog) bundle(folder, file string) {
+	for i, item := range c.Items {
+		if item.Entry == "" && strings.HasPrefix(item.Archived, folder+"/") {
+			c.Items[i].Archived = file
+			c.Items[i].Entry = strings.TrimPrefix(item.Archived, folder+"/")
+		}
+	}
+	c.reindex()
+}
+
+// forget drops p, and everything inside it, from the catalog.
+func (c *sweepCatalog) forget(p string) {
+	items := []catalogItem{}
+	for _, item := range c.Items {
+		if !item.under(p) {
+			items = append(items, item)
+		}
+	}
+	c.Items = items
+	c.reindex()
+}
+
+// lookup finds an item by its ID, where it is in the archive or, failing
+// that, the most recent item swept from that original location.
+func (c *sweepCatalog) lookup(ref string) (catalogItem, error) {
+	if i, ok := c.index[ref]; ok {
+		return c.Items[i], nil
+	}
+	var found *catalogItem
+	for i, item := range c.Items {
+		if item.ID == ref {
+			return item, nil
+		}
+		if item.Original == ref && (found == nil || item.SweptAt.After(found.SweptAt)) {
+			found = &c.Items[i]
+		}
+	}
+	if found == nil {
+		return catalogItem{}, fmt.Errorf("no swept item %q", ref)
+	}
+	return *found, nil
+}
+
+// markRestored records that item, and everything inside it, was put back at dst.
+func (c *sweepCatalog) markRestored(item catalogItem, dst string, at time.Time) {
+	for i, other := range c.Items {
+		switch {
+		case item.Entry == "" && other.Entry == "" && other.under(item.Archived):
+			c.Items[i].RestoredTo = dst + strings.TrimPrefix(other.Archived, item.Archived)
+		case item.Entry != "" && other.Archived == item.Archived && (other.Entry == item.Entry || strings.HasPrefix(other.Entry, item.Entry+"/")):
+			c.Items[i].RestoredTo = dst + strings.TrimPrefix(other.Entry, item.Entry)
+		default:
+			continue
+		}
+		c.Items[i].RestoredAt = &at
+	}
+}
+
+// search returns the items whose original or archived path contains every
+// word of the query, ignoring case, most recently swept first.
+func (c *sweepCatalog) search(query string) []catalogItem {
+	terms := strings.Fields(strings.ToLower(query))
+	found := []catalogItem{}
+	for _, item := range c.Items {
+		text := strings.ToLower(item.Original + "\n" + item.location())
+		match := true
+		for _, t := range terms {
+			if !strings.Contains(text, t) {
+				match = false
+				break
+			}
+		}
+		if match {
+			found = append(found, item)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].SweptAt.After(found[j].SweptAt) })
+	return found
+}
+
+// writeCatalogItems prints the items as a table, one per line.
+func writeCatalogItems(w io.Writer, items []catalogItem) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSWEPT\tSIZE\tARCHIVED\tORIGINAL\tRESTORED")
+	for _, item := range items {
+		swept := ""
+		if !item.SweptAt.IsZero() {
+			swept = item.SweptAt.Format("2006-01-02 15:04")
+		}
+		size := fmt.Sprint(item.Size)
+		if item.IsDir {
+			size = "-"
+		}
+		restored := ""
+		if item.RestoredAt != nil {
+			restored = item.RestoredAt.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", item.ID, swept, size, item.location(), item.Original, restored)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,665 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Exit codes of the command line. Partial means some items or profiles were
+// handled and others failed.
+const (
+	exitOK      int = 0
+	exitFailed  int = 1
+	exitUsage   int = 2
+	exitPartial int = 3
+)
+
+const cliUsage string = `Usage: DeskClean [command] [arguments]
+
+Without a command the tray app is started. The -dry-run and -undo flags of
+older versions still work and run preview and undo.
+
+Commands:
+  sweep [-profile name]         sweep every profile, or only the named one
+  preview [-profile name]       print what a sweep would do without touching any files
+  config get [key]              print every setting, or the value of one
+  config set key value...       change a setting, list settings take several values
+  config unset key              forget a setting, going back to the team baseline or default
+  config export [file]          write the configuration as YAML, or JSON for a .json file
+  config import file            read settings from a file written by config export
+  history [-n count] [id]       list the most recent sweeps, or everything recorded
+                                about one of them, failures included
+  undo                          move everything from the last sweep back
+  find [-n count] [-json] query list swept items whose original or archived path
+                                contains every word of the query
+  restore [-collision policy] item
+                                move a single swept item, given by its find ID or
+                                path, back to where it was swept from
+  move-archive folder           move the archive and everything already in it to folder
+  retention [-confirm]          print which archive folders the retention policy merges,
+                                compresses or deletes, and with -confirm carry it out
+  daemon                        run every profile on its schedule without a display
+  daemon install [-timer when]  install and start a systemd user unit for the daemon,
+                                or a timer sweeping at the OnCalendar times when
+  daemon uninstall              stop and remove the systemd user units
+  daemon units [-timer when]    print the systemd user units instead of installing them
+  help                          print this help
+
+Exit codes: 0 success, 1 failure, 2 usage error, 3 partial failure.
+`
+
+// cliFlagAliases are the flags of versions before commands and the commands
+// they stand for.
+var cliFlagAliases = map[string]string{
+	"-dry-run":  "preview",
+	"--dry-run": "preview",
+	"-undo":     "undo",
+	"--undo":    "undo",
+}
+
+// cliCommand runs a subcommand with its arguments and returns the exit code.
+type cliCommand func(pref *filePreferences, appName string, args []string) int
+
+var cliCommands = map[string]cliCommand{
+	"sweep":        sweepCommand,
+	"preview":      previewCommand,
+	"config":       configCommand,
+	"history":      historyCommand,
+	"undo":         undoCommand,
+	"find":         findCommand,
+	"restore":      restoreCommand,
+	"retention":    retentionCommand,
+	"move-archive": moveArchiveCommand,
+	"daemon":       daemonCommand,
+}
+
+// runCommand runs the command line without starting Fyne. The preferences are
+// read from the same file the tray app uses.
+func runCommand(args []string) int {
+	if args[0] == "help" {
+		fmt.Print(cliUsage)
+		return exitOK
+	}
+	cmd, ok := cliCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q.\n\n%s", args[0], cliUsage)
+		return exitUsage
+	}
+
+	// Output is for people and scripts, so only problems are logged and to stderr
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	pref, err := loadPreferences(getPreferencesFile(runtime.GOOS))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to read preferences:", err)
+		return exitFailed
+	}
+	return cmd(pref, pref.StringWithFallback("AppName", appNameDefault), args[1:])
+}
+
+// loadPreferences opens the preferences in file over the team baseline and
+// upgrades them from older versions, the way the tray app does at startup.
+func loadPreferences(file string) (*filePreferences, error) {
+	pref, err := openPreferences(file)
+	if err != nil {
+		return nil, err
+	}
+	pref.base = loadBaseline(getBaselineFile(runtime.GOOS))
+	migratePreferences(pref)
+	return pref, nil
+}
+
+// exitCode turns the number of things that worked and failed into an exit code.
+func exitCode(done, failed int) int {
+	switch {
+	case failed == 0:
+		return exitOK
+	case done == 0:
+		return exitFailed
+	default:
+		return exitPartial
+	}
+}
+
+// selectProfiles returns every profile, or only the one called name when it is set.
+func selectProfiles(pref *filePreferences, name string) ([]sweepProfile, error) {
+	profiles := loadProfiles(pref)
+	if name == "" {
+		return profiles, nil
+	}
+	p, ok := findProfile(profiles, name)
+	if !ok {
+		return nil, fmt.Errorf("no profile named %q", name)
+	}
+	return []sweepProfile{p}, nil
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+func sweepCommand(pref *filePreferences, appName string, args []string) int {
+	fs := newFlagSet("sweep")
+	profileName := fs.String("profile", "", "only sweep the named profile")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	profiles, err := selectProfiles(pref, *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	done, failed := 0, 0
+	for _, p := range profiles {
+		plan, err := runSweep(pref, appName, p, nil, triggerCommandLine)
+		counts := map[sweepAction]int{}
+		for _, m := range plan {
+			if m.Error != "" {
+				fmt.Fprintf(os.Stderr, "%s: unable to %s %s: %s\n", p.Name, m.Action, m.Source, m.Error)
+				continue
+			}
+			counts[m.Action]++
+		}
+		failed += plan.countFailed()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: unable to sweep: %s\n", p.Name, err)
+			failed++
+			continue
+		}
+		done++
+		fmt.Printf("%s: %d moved, %d deleted, %d trashed, %d skipped, %d failed\n", p.Name,
+			counts[actionMove], counts[actionDelete], counts[actionTrash], counts[actionSkip], plan.countFailed())
+	}
+
+	retained, err := runRetention(pref, appName, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to enforce retention policy:", err)
+		failed++
+	}
+	failed += retained.countFailed()
+	return exitCode(done, failed)
+}
+
+func previewCommand(pref *filePreferences, appName string, args []string) int {
+	fs := newFlagSet("preview")
+	profileName := fs.String("profile", "", "only preview the named profile")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	profiles, err := selectProfiles(pref, *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	done, failed := 0, 0
+	for _, p := range profiles {
+		fmt.Printf("Profile %s (%s)\n", p.Name, p.SourcePath)
+		plan, err := previewSweep(pref, appName, p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: unable to plan sweep: %s\n", p.Name, err)
+			failed++
+			continue
+		}
+		plan.write(os.Stdout)
+		done++
+	}
+	return exitCode(done, failed)
+}
+
+// prefValidators check the settings that have a format of their own before
+// config set stores them.
+var prefValidators = map[string]func(values []string) error{
+	"CollisionPolicy": func(values []string) error {
+		if !slices.Contains(allowedCollisionPolicies, values[0]) {
+			return fmt.Errorf("expected one of: %s", strings.Join(allowedCollisionPolicies, ", "))
+		}
+		return nil
+	},
+	"DuplicatePolicy": func(values []string) error {
+		if !slices.Contains(allowedDuplicatePolicies, values[0]) {
+			return fmt.Errorf("expected one of: %s", strings.Join(allowedDuplicatePolicies, ", "))
+		}
+		return nil
+	},
+	"DuplicateHash": func(values []string) error {
+		if !slices.Contains(allowedHashAlgorithms, values[0]) {
+			return fmt.Errorf("expected one of: %s", strings.Join(allowedHashAlgorithms, ", "))
+		}
+		return nil
+	},
+	"NotifyPolicy": func(values []string) error {
+		if !slices.Contains(allowedNotifyPolicies, values[0]) {
+			return fmt.Errorf("expected one of: %s", strings.Join(allowedNotifyPolicies, ", "))
+		}
+		return nil
+	},
+	"QuietHoursStart": validateClock,
+	"QuietHoursEnd":   validateClock,
+	"BundleFormat": func(values []string) error {
+		if !slices.Contains(allowedBundleFormats, values[0]) {
+			return fmt.Errorf("expected one of: %s", strings.Join(allowedBundleFormats, ", "))
+		}
+		return nil
+	},
+	"Rules": func(values []string) error {
+		for _, v := range values {
+			if _, err := parseRule(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	"IgnorePatterns": func(values []string) error {
+		for _, v := range values {
+			if _, err := parseIgnorePattern(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	"Profiles": func(values []string) error {
+		profiles := []sweepProfile{}
+		if err := json.Unmarshal([]byte(values[0]), &profiles); err != nil {
+			return err
+		}
+		if len(profiles) == 0 {
+			return errors.New("at least one profile is needed")
+		}
+		for i, p := range profiles {
+			if err := checkProfileName(profiles, i, p.Name); err != nil {
+				return err
+			}
+			if p.MinimumAge < 0 {
+				return fmt.Errorf("minimum age of profile %s may not be negative", p.Name)
+			}
+			if _, err := p.folderTemplate(); err != nil {
+				return err
+			}
+			if !slices.Contains(allowedDateBases, string(p.dateBasis())) {
+				return fmt.Errorf("date basis of profile %s must be one of: %s", p.Name, strings.Join(allowedDateBases, ", "))
+			}
+			// An empty schedule means on demand
+			if p.Schedule != "" {
+				if _, err := describeSchedule(p.Schedule, time.Now()); err != nil {
+					return fmt.Errorf("invalid schedule for profile %s: %w", p.Name, err)
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// validateClock accepts a time of day, or nothing to turn the setting off.
+func validateClock(values []string) error {
+	if values[0] == "" {
+		return nil
+	}
+	_, err := parseClock(values[0])
+	return err
+}
+
+// prefTypes give the type of settings that may not be stored yet, so config
+// set stores them the way the tray app reads them.
+var prefTypes = map[string]any{
+	"Rules":                   []any{},
+	"IgnorePatterns":          []any{},
+	"AutoLaunchApp":           false,
+	"RetentionDailyDays":      0,
+	"RetentionKeepDays":       0,
+	"BundleAfterDays":         0,
+	"RetentionConfirmDeletes": true,
+}
+
+func configCommand(pref *filePreferences, _ string, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "get":
+		if len(args) == 1 {
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			for _, key := range pref.keys() {
+				v, _ := pref.get(key)
+				origin := ""
+				if pref.fromBaseline(key) {
+					origin = "  (team baseline)"
+				}
+				fmt.Fprintf(tw, "%s\t%s%s\n", key, formatPref(v), origin)
+			}
+			tw.Flush()
+			return exitOK
+		}
+		v, ok := pref.get(args[1])
+		if !ok {
+			fmt.Fprintf(os.Stderr, "No setting named %q.\n", args[1])
+			return exitFailed
+		}
+		writePref(os.Stdout, v)
+		return exitOK
+	case "set":
+		if len(args) < 3 {
+			fmt.Fprint(os.Stderr, cliUsage)
+			return exitUsage
+		}
+		if err := setPref(pref, args[1], args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to set %s: %s\n", args[1], err)
+			return exitFailed
+		}
+		if err := pref.save(); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to save preferences:", err)
+			return exitFailed
+		}
+		return exitOK
+	case "unset":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, cliUsage)
+			return exitUsage
+		}
+		if slices.Contains(archiveRootKeys, args[1]) {
+			fmt.Fprintf(os.Stderr, "Unable to unset %s: use move-archive to move the archive along with everything in it\n", args[1])
+			return exitFailed
+		}
+		pref.RemoveValue(args[1])
+		return exitOK
+	case "export":
+		if len(args) > 2 {
+			fmt.Fprint(os.Stderr, cliUsage)
+			return exitUsage
+		}
+		var err error
+		if len(args) == 1 {
+			err = writeConfig(os.Stdout, exportConfig(pref), false)
+		} else {
+			err = exportConfigFile(pref, args[1])
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to export configuration:", err)
+			return exitFailed
+		}
+		return exitOK
+	case "import":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, cliUsage)
+			return exitUsage
+		}
+		if err := importConfigFile(pref, args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to import configuration:", err)
+			return exitFailed
+		}
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown config command %q.\n\n%s", args[0], cliUsage)
+		return exitUsage
+	}
+}
+
+// setPref stores values under key as the type the key already holds, so
+// the tray app reads it back the way it wrote it.
+func setPref(pref *filePreferences, key string, values []string) error {
+	if slices.Contains(archiveRootKeys, key) {
+		return errors.New("use move-archive to move the archive along with everything in it")
+	}
+	current, ok := prefTypes[key]
+	if !ok {
+		current, _ = pref.get(key)
+	}
+	isList := false
+	switch current.(type) {
+	case []any, []string:
+		isList = true
+	}
+	if !isList && len(values) > 1 {
+		return errors.New("expected a single value")
+	}
+	if validate, ok := prefValidators[key]; ok {
+		if err := validate(values); err != nil {
+			return err
+		}
+	}
+
+	switch current.(type) {
+	case bool:
+		b, err := strconv.ParseBool(values[0])
+		if err != nil {
+			return err
+		}
+		pref.SetBool(key, b)
+	case float64, int:
+		if n, err := strconv.Atoi(values[0]); err == nil {
+			pref.SetInt(key, n)
+			return nil
+		}
+		f, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return err
+		}
+		pref.SetFloat(key, f)
+	default:
+		if isList {
+			pref.SetStringList(key, values)
+			return nil
+		}
+		pref.SetString(key, values[0])
+	}
+	return nil
+}
+
+// formatPref renders a value on a single line, lists as JSON.
+func formatPref(v any) string {
+	switch v.(type) {
+	case []any, []string:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
+
+// writePref prints a value, lists one item per line.
+func writePref(w io.Writer, v any) {
+	switch items := v.(type) {
+	case []any:
+		for _, item := range items {
+			fmt.Fprintln(w, item)
+		}
+	case []string:
+		for _, item := range items {
+			fmt.Fprintln(w, item)
+		}
+	default:
+		fmt.Fprintln(w, v)
+	}
+}
+
+func historyCommand(_ *filePreferences, appName string, args []string) int {
+	fs := newFlagSet("history")
+	count := fs.Int("n", 20, "number of sweeps to list")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() > 1 {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return exitUsage
+	}
+	if fs.NArg() == 1 {
+		m, err := loadManifest(path.Join(getManifestDir(appName), fs.Arg(0)+manifestExt))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to read sweep:", err)
+			return exitFailed
+		}
+		m.writeDetails(os.Stdout)
+		return exitOK
+	}
+
+	manifests, err := listManifests(getManifestDir(appName))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to read sweep history:", err)
+		return exitFailed
+	}
+	if *count > 0 && len(manifests) > *count {
+		manifests = manifests[:*count]
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSWEPT\tDURATION\tPROFILE\tTRIGGER\tMOVED\tBYTES\tDELETED\tSKIPPED\tFAILED\tRESTORED\tUNDONE")
+	for _, m := range manifests {
+		profile := m.Profile
+		if m.Kind != "" {
+			profile = "(" + m.Kind + ")"
+		}
+		undone := ""
+		if m.UndoneAt != nil {
+			undone = m.UndoneAt.Format("2006-01-02 15:04")
+		}
+		duration := ""
+		if m.FinishedAt != nil {
+			duration = m.duration().String()
+		}
+		failed := fmt.Sprint(len(m.Failed))
+		if m.Error != "" {
+			failed += " (stopped)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%d\t%d\t%s\t%d\t%s\n", m.ID, m.SweptAt.Format("2006-01-02 15:04"), duration, profile, m.Trigger,
+			len(m.Moves), formatBytes(m.BytesMoved), len(m.Deleted), m.Skipped, failed, len(m.Restored), undone)
+	}
+	tw.Flush()
+	return exitOK
+}
+
+func findCommand(pref *filePreferences, appName string, args []string) int {
+	fs := newFlagSet("find")
+	count := fs.Int("n", 50, "number of items to list, 0 for all")
+	asJSON := fs.Bool("json", false, "print the items as JSON")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	c, err := openCatalog(pref, appName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to read catalog:", err)
+		return exitFailed
+	}
+	items := c.search(strings.Join(fs.Args(), " "))
+	if len(items) == 0 {
+		fmt.Fprintln(os.Stderr, "Nothing found.")
+		return exitFailed
+	}
+	if *count > 0 && len(items) > *count {
+		items = items[:*count]
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(items); err != nil {
+			return exitFailed
+		}
+		return exitOK
+	}
+	writeCatalogItems(os.Stdout, items)
+	return exitOK
+}
+
+func restoreCommand(pref *filePreferences, appName string, args []string) int {
+	fs := newFlagSet("restore")
+	collision := fs.String("collision", pref.StringWithFallback("CollisionPolicy", string(collisionNumber)), "what to do when the original location is taken: "+strings.Join(allowedCollisionPolicies, ", "))
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 || !slices.Contains(allowedCollisionPolicies, *collision) {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return exitUsage
+	}
+
+	item, dst, err := restoreSwept(pref, appName, fs.Arg(0), collisionPolicy(*collision))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to restore:", err)
+		return exitFailed
+	}
+	fmt.Printf("Restored %s to %s\n", item.location(), dst)
+	return exitOK
+}
+
+func undoCommand(pref *filePreferences, appName string, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return exitUsage
+	}
+
+	report, err := undoSweep(pref, appName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to undo last sweep:", err)
+		return exitFailed
+	}
+	report.write(os.Stdout)
+	return exitCode(len(report.Restored), len(report.Conflicts)+len(report.Missing)+len(report.Failed))
+}
+
+func moveArchiveCommand(pref *filePreferences, appName string, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return exitUsage
+	}
+	root, err := filepath.Abs(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to move archive:", err)
+		return exitFailed
+	}
+	root = filepath.ToSlash(root)
+
+	n, err := moveArchive(pref, appName, root)
+	if err := pref.save(); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to save preferences:", err)
+		return exitFailed
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to move archive:", err)
+		return exitCode(n, 1)
+	}
+	fmt.Printf("Moved %d items to %s\n", n, root)
+	return exitOK
+}
+
+func retentionCommand(pref *filePreferences, appName string, args []string) int {
+	fs := newFlagSet("retention")
+	confirm := fs.Bool("confirm", false, "merge and delete the listed folders")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if !*confirm {
+		plan, err := previewRetention(pref, time.Now())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to plan retention:", err)
+			return exitFailed
+		}
+		plan.write(os.Stdout)
+		return exitOK
+	}
+
+	plan, err := runRetention(pref, appName, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to enforce retention policy:", err)
+		return exitFailed
+	}
+	plan.write(os.Stdout)
+	return exitCode(len(plan)-plan.countFailed(), plan.countFailed())
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// collisionPolicy decides what happens when a sweep destination already exists.
+type collisionPolicy string
+
+const (
+	collisionNumber    collisionPolicy = "append number"
+	collisionTimestamp collisionPolicy = "append timestamp"
+	collisionSkip      collisionPolicy = "skip"
+	collisionOverwrite collisionPolicy = "overwrite"
+	collisionNewer     collisionPolicy = "keep newer"
+
+	collisionStamp string = "20060102T150405"
+)
+
+var allowedCollisionPolicies = []string{string(collisionNumber), string(collisionTimestamp), string(collisionSkip), string(collisionOverwrite), string(collisionNewer)}
+
+// resolveCollision applies the policy to a planned move whose destination is
+// taken, either on disk or by an earlier entry of the same plan. The move is
+// updated in place with the new destination, or turned into a skip.
+func resolveCollision(m *plannedMove, policy collisionPolicy, now time.Time, taken func(string) bool) error {
+	m.Collision = policy
+
+	switch policy {
+	case collisionTimestamp:
+		m.Destination = freeName(withSuffix(m.Destination, "-"+now.Format(collisionStamp)), taken)
+	case collisionSkip:
+		m.Action = actionSkip
+		m.SkipReason = "destination exists"
+		m.Destination = ""
+	case collisionOverwrite:
+		// Keep the destination, the existing copy is replaced when the plan runs
+	case collisionNewer:
+		src, err := os.Stat(m.Source)
+		if err != nil {
+			return err
+		}
+		dst, err := os.Stat(m.Destination)
+		if err != nil {
+			return err
+		}
+		if !src.ModTime().After(dst.ModTime()) {
+			m.Action = actionSkip
+			m.SkipReason = "archived copy is newer"
+			m.Destination = ""
+		}
+	default:
+		m.Collision = collisionNumber
+		m.Destination = freeName(m.Destination, taken)
+	}
+	return nil
+}
+
+// freeName returns p, or p with the first free numeric suffix if p is taken.
+func freeName(p string, taken func(string) bool) string {
+	candidate := p
+	for i := 1; taken(candidate); i++ {
+		candidate = withSuffix(p, fmt.Sprintf(" (%d)", i))
+	}
+	return candidate
+}
+
+// withSuffix inserts suffix between the name and extension of p.
+func withSuffix(p, suffix string) string {
+	ext := path.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	if base == "" || strings.HasSuffix(base, "/") {
+		// Names such as ".profile" are all extension
+		return p + suffix
+	}
+	return base + suffix + ext
+}
+
+// exists reports whether anything, including a dangling symlink, is at p.
+func exists(p string) bool {
+	_, err := os.Lstat(p)
+	return !errors.Is(err, os.ErrNotExist)
+}
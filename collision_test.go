@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestResolveCollision(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"Desktop/report.pdf":                 "new",
+		"Desktop/old.pdf":                    "old",
+		"Archive/report.pdf":                 "archived",
+		"Archive/report (1).pdf":             "archived",
+		"Archive/old.pdf":                    "archived",
+		"Archive/.profile":                   "archived",
+		"Archive/notes.tar.gz":               "archived",
+		"Archive/report-20261016T093000.pdf": "archived",
+	})
+	older, newer := time.Now().Add(-time.Hour), time.Now()
+	for file, stamp := range map[string]time.Time{"Desktop/report.pdf": newer, "Archive/report.pdf": older, "Desktop/old.pdf": older, "Archive/old.pdf": newer} {
+		if err := os.Chtimes(path.Join(dir, file), time.Time{}, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Date(2026, time.October, 16, 9, 30, 0, 0, time.UTC)
+	archived := func(name string) string { return path.Join(dir, "Archive", name) }
+
+	tests := []struct {
+		name       string
+		source     string
+		dest       string
+		policy     collisionPolicy
+		want       string
+		action     sweepAction
+		skipReason string
+	}{
+		{"number", "report.pdf", "report.pdf", collisionNumber, archived("report (2).pdf"), actionMove, ""},
+		{"unknown policy numbers", "report.pdf", "report.pdf", "", archived("report (2).pdf"), actionMove, ""},
+		{"dot file", "report.pdf", ".profile", collisionNumber, archived(".profile (1)"), actionMove, ""},
+		{"double extension", "report.pdf", "notes.tar.gz", collisionNumber, archived("notes.tar (1).gz"), actionMove, ""},
+		{"timestamp", "report.pdf", "report.pdf", collisionTimestamp, archived("report-20261016T093000 (1).pdf"), actionMove, ""},
+		{"skip", "report.pdf", "report.pdf", collisionSkip, "", actionSkip, "destination exists"},
+		{"overwrite", "report.pdf", "report.pdf", collisionOverwrite, archived("report.pdf"), actionMove, ""},
+		{"newer source", "report.pdf", "report.pdf", collisionNewer, archived("report.pdf"), actionMove, ""},
+		{"newer archived copy", "old.pdf", "old.pdf", collisionNewer, "", actionSkip, "archived copy is newer"},
+	}
+	for _, tt := range tests {
+		m := plannedMove{Source: path.Join(dir, "Desktop", tt.source), Destination: archived(tt.dest), Action: actionMove}
+		if err := resolveCollision(&m, tt.policy, now, exists); err != nil {
+			t.Errorf("%s: resolveCollision: %v", tt.name, err)
+			continue
+		}
+		if m.Destination != tt.want || m.Action != tt.action || m.SkipReason != tt.skipReason {
+			t.Errorf("%s: resolveCollision = %s %q (%s), want %s %q (%s)", tt.name, m.Action, m.Destination, m.SkipReason, tt.action, tt.want, tt.skipReason)
+		}
+	}
+
+	// Names taken by earlier entries of the same plan count as well
+	planned := map[string]bool{archived("report (2).pdf"): true}
+	taken := func(p string) bool { return planned[p] || exists(p) }
+	m := plannedMove{Source: path.Join(dir, "Desktop", "report.pdf"), Destination: archived("report.pdf"), Action: actionMove}
+	if err := resolveCollision(&m, collisionNumber, now, taken); err != nil || m.Destination != archived("report (3).pdf") {
+		t.Errorf("resolveCollision with a planned name = %q, %v, want report (3).pdf", m.Destination, err)
+	}
+
+	m = plannedMove{Source: path.Join(dir, "Desktop", "missing.pdf"), Destination: archived("report.pdf"), Action: actionMove}
+	if err := resolveCollision(&m, collisionNewer, now, exists); err == nil {
+		t.Error("keep newer with a missing source should fail")
+	}
+}
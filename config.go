@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"github.com/adrg/xdg"
+	"gopkg.in/yaml.v3"
+)
+
+// configVersion is the version of the configuration file format. Files from a
+// newer version are refused rather than half understood.
+const configVersion int = 2
+
+// configRenames maps settings renamed since a configuration version to their
+// new names, so files exported by older versions still import.
+var configRenames = map[int]map[string]string{
+	2: {"TargetFolderSeperator": "TargetFolderSeparator"},
+}
+
+// configDefaults lists the settings a configuration file holds, with the value
+// each one has when it is not set. Machine state such as the last sweep time
+// is left out so files can be shared.
+var configDefaults = map[string]any{
+	"HomeDir":                 "",
+	"AppFolder":               appNameDefault,
+	"TargetFolderSeparator":   "-",
+	"CollisionPolicy":         string(collisionNumber),
+	"DuplicatePolicy":         string(duplicateOff),
+	"DuplicateHash":           string(hashSHA256),
+	"NotifyPolicy":            string(notifyErrors),
+	"QuietHoursStart":         "",
+	"QuietHoursEnd":           "",
+	"Rules":                   []string{},
+	"IgnorePatterns":          []string{},
+	"Profiles":                []sweepProfile{},
+	"RetentionDailyDays":      0,
+	"RetentionKeepDays":       0,
+	"RetentionConfirmDeletes": true,
+	"BundleAfterDays":         0,
+	"BundleFormat":            string(bundleZip),
+	"AutoLaunchApp":           false,
+}
+
+// configDocument is the file written by export and read by import and as the
+// team baseline. Settings use the same names as config get and set.
+type configDocument struct {
+	Version  int            `json:"version" yaml:"version"`
+	Settings map[string]any `json:"settings" yaml:"settings"`
+}
+
+// configIsJSON picks the file format from the name, YAML unless it ends in .json.
+func configIsJSON(file string) bool {
+	return strings.EqualFold(path.Ext(file), ".json")
+}
+
+// shortenHome writes paths in the home folder from ~ so they fit whoever imports them.
+func shortenHome(p string) string {
+	if within(p, xdg.Home) {
+		return "~" + strings.TrimPrefix(p, xdg.Home)
+	}
+	return p
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		return xdg.Home + strings.TrimPrefix(p, "~")
+	}
+	return p
+}
+
+// exportConfig collects the configuration in effect, baseline included.
+func exportConfig(pref fyne.Preferences) configDocument {
+	doc := configDocument{Version: configVersion, Settings: map[string]any{}}
+	for key, fallback := range configDefaults {
+		switch v := fallback.(type) {
+		case string:
+			if s := pref.StringWithFallback(key, v); s != "" {
+				if key == "HomeDir" {
+					s = shortenHome(s)
+				}
+				doc.Settings[key] = s
+			}
+		case int:
+			doc.Settings[key] = pref.IntWithFallback(key, v)
+		case bool:
+			doc.Settings[key] = pref.BoolWithFallback(key, v)
+		case []string:
+			if list := pref.StringList(key); len(list) > 0 {
+				doc.Settings[key] = list
+			}
+		case []sweepProfile:
+			profiles := loadProfiles(pref)
+			for i := range profiles {
+				profiles[i].SourcePath = shortenHome(profiles[i].SourcePath)
+			}
+			doc.Settings[key] = profiles
+		}
+	}
+	return doc
+}
+
+// writeConfig writes the document as YAML, or JSON when asJSON is set.
+func writeConfig(w io.Writer, doc configDocument, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	}
+	// Go through JSON so profiles keep the field names they are stored with
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	generic := configDocument{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "# DeskClean configuration, load it with: DeskClean config import <file>")
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(generic); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// readConfig reads a configuration file in either format and checks its version.
+func readConfig(file string) (configDocument, error) {
+	doc := configDocument{}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return doc, err
+	}
+	if configIsJSON(file) {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return doc, fmt.Errorf("unable to read %s: %w", file, err)
+	}
+	switch {
+	case doc.Version == 0:
+		return doc, fmt.Errorf("%s is not a DeskClean configuration, it has no version", file)
+	case doc.Version > configVersion:
+		return doc, fmt.Errorf("%s is configuration version %d, this DeskClean only reads up to version %d", file, doc.Version, configVersion)
+	}
+	for v := doc.Version + 1; v <= configVersion; v++ {
+		for old, key := range configRenames[v] {
+			if value, ok := doc.Settings[old]; ok {
+				delete(doc.Settings, old)
+				doc.Settings[key] = value
+			}
+		}
+	}
+	doc.Version = configVersion
+	return doc, nil
+}
+
+// importConfig checks every setting of the document and only then stores
+// them. Settings the document leaves out keep their current value.
+func importConfig(pref fyne.Preferences, doc configDocument) error {
+	keys := make([]string, 0, len(doc.Settings))
+	for key := range doc.Settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	apply := []func(){}
+	for _, key := range keys {
+		set, err := configSetter(pref, key, doc.Settings[key])
+		if err != nil {
+			return fmt.Errorf("setting %s: %w", key, err)
+		}
+		apply = append(apply, set)
+	}
+	if err := checkImportedArchiveRoot(pref, doc); err != nil {
+		return err
+	}
+	for _, set := range apply {
+		set()
+	}
+	return nil
+}
+
+// archiveRootKeys decide where the archive is. Setting them on their own
+// would leave everything archived so far behind, so they only change through
+// moveArchive.
+var archiveRootKeys = []string{"HomeDir", "AppFolder"}
+
+// checkImportedArchiveRoot refuses a configuration that would point the
+// archive somewhere else.
+func checkImportedArchiveRoot(pref fyne.Preferences, doc configDocument) error {
+	home, _ := doc.Settings["HomeDir"].(string)
+	folder, _ := doc.Settings["AppFolder"].(string)
+	if home == "" {
+		home = pref.String("HomeDir")
+	}
+	if folder == "" {
+		folder = pref.String("AppFolder")
+	}
+	if root := path.Join(expandHome(home), folder); root != getArchiveRoot(pref) {
+		return fmt.Errorf("the configuration puts the archive in %s, move it there first with move-archive or leave out HomeDir and AppFolder", root)
+	}
+	return nil
+}
+
+// configSetter converts and validates value for key, returning the function
+// that stores it.
+func configSetter(pref fyne.Preferences, key string, value any) (func(), error) {
+	fallback, ok := configDefaults[key]
+	if !ok {
+		return nil, errors.New("unknown setting")
+	}
+	validate := func(values ...string) error {
+		if v, ok := prefValidators[key]; ok {
+			return v(values)
+		}
+		return nil
+	}
+
+	switch fallback.(type) {
+	case string:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected text, got %v", value)
+		}
+		if key == "HomeDir" {
+			if s = expandHome(s); !path.IsAbs(s) {
+				return nil, fmt.Errorf("%s is not an absolute path", s)
+			}
+		}
+		if err := validate(s); err != nil {
+			return nil, err
+		}
+		return func() { pref.SetString(key, s) }, nil
+	case int:
+		var n int
+		switch v := value.(type) {
+		case int:
+			n = v
+		case float64:
+			n = int(v)
+			if float64(n) != v {
+				return nil, fmt.Errorf("expected a whole number, got %v", value)
+			}
+		default:
+			return nil, fmt.Errorf("expected a number, got %v", value)
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("expected 0 or more, got %d", n)
+		}
+		return func() { pref.SetInt(key, n) }, nil
+	case bool:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected true or false, got %v", value)
+		}
+		return func() { pref.SetBool(key, b) }, nil
+	case []string:
+		items, ok := value.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected a list, got %v", value)
+		}
+		list := []string{}
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected text, got %v", item)
+			}
+			list = append(list, s)
+		}
+		if len(list) > 0 {
+			if err := validate(list...); err != nil {
+				return nil, err
+			}
+		}
+		return func() { pref.SetStringList(key, list) }, nil
+	case []sweepProfile:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		profiles := []sweepProfile{}
+		if err := json.Unmarshal(data, &profiles); err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for i := range profiles {
+			profiles[i].SourcePath = expandHome(profiles[i].SourcePath)
+			profiles[i].migrateRunInterval()
+			if slices.Contains(names, profiles[i].Name) {
+				return nil, fmt.Errorf("two profiles are called %s", profiles[i].Name)
+			}
+			names = append(names, profiles[i].Name)
+		}
+		if data, err = json.Marshal(profiles); err != nil {
+			return nil, err
+		}
+		if err := validate(string(data)); err != nil {
+			return nil, err
+		}
+		return func() { pref.SetString(key, string(data)) }, nil
+	}
+	return nil, errors.New("unknown setting")
+}
+
+// importConfigFile reads file and stores its settings.
+func importConfigFile(pref fyne.Preferences, file string) error {
+	doc, err := readConfig(file)
+	if err != nil {
+		return err
+	}
+	if err := importConfig(pref, doc); err != nil {
+		return err
+	}
+	slog.Info("Imported configuration.", slog.String("file", file), slog.Int("settingCount", len(doc.Settings)))
+	return nil
+}
+
+// exportConfigFile writes the configuration in effect to file.
+func exportConfigFile(pref fyne.Preferences, file string) error {
+	var buf bytes.Buffer
+	if err := writeConfig(&buf, exportConfig(pref), configIsJSON(file)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	slog.Info("Exported configuration.", slog.String("file", file))
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adrg/xdg"
+)
+
+func TestImportConfigArchiveRoot(t *testing.T) {
+	dir := t.TempDir()
+	pref, err := openPreferences(path.Join(dir, "preferences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setArchiveRoot(pref, path.Join(dir, "DeskClean"))
+
+	tests := []struct {
+		name     string
+		settings map[string]any
+		err      string
+	}{
+		{"left out", map[string]any{"CollisionPolicy": "skip"}, ""},
+		{"same place", map[string]any{"HomeDir": dir, "AppFolder": "DeskClean"}, ""},
+		{"other folder", map[string]any{"AppFolder": "Elsewhere"}, "move-archive"},
+		{"other home", map[string]any{"HomeDir": "/mnt/backup"}, "move-archive"},
+	}
+	for _, tt := range tests {
+		err := importConfig(pref, configDocument{Version: configVersion, Settings: tt.settings})
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: importConfig: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: importConfig error = %v, want one containing %q", tt.name, err, tt.err)
+		}
+		if root := getArchiveRoot(pref); root != path.Join(dir, "DeskClean") {
+			t.Fatalf("%s: archive root = %s, want it unchanged", tt.name, root)
+		}
+	}
+
+	if err := setPref(pref, "AppFolder", []string{"Elsewhere"}); err == nil {
+		t.Error("setPref(AppFolder) should point to move-archive")
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		data string
+		err  string
+		want map[string]any
+	}{
+		{"config.yaml", "version: 2\nsettings:\n  CollisionPolicy: skip\n  RetentionKeepDays: 30\n", "", map[string]any{"CollisionPolicy": "skip", "RetentionKeepDays": 30}},
+		{"config.json", `{"version": 2, "settings": {"Rules": ["*.tmp -> delete"]}}`, "", map[string]any{"Rules": []any{"*.tmp -> delete"}}},
+		{"CONFIG.JSON", `{"version": 2, "settings": {}}`, "", map[string]any{}},
+		// Version 1 files used the misspelled separator key
+		{"old.yaml", "version: 1\nsettings:\n  TargetFolderSeperator: _\n", "", map[string]any{"TargetFolderSeparator": "_"}},
+		{"none.yaml", "settings:\n  CollisionPolicy: skip\n", "has no version", nil},
+		{"newer.yaml", "version: 99\nsettings: {}\n", "only reads up to version", nil},
+		{"broken.json", `{"version": 2,`, "unable to read", nil},
+		{"broken.yaml", "version: [2\n", "unable to read", nil},
+	}
+	for _, tt := range tests {
+		file := path.Join(dir, tt.name)
+		if err := os.WriteFile(file, []byte(tt.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		doc, err := readConfig(file)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("readConfig(%s) error = %v, want one containing %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("readConfig(%s): %v", tt.name, err)
+			continue
+		}
+		if doc.Version != configVersion || !reflect.DeepEqual(doc.Settings, tt.want) {
+			t.Errorf("readConfig(%s) = version %d, %v, want version %d, %v", tt.name, doc.Version, doc.Settings, configVersion, tt.want)
+		}
+	}
+
+	if _, err := readConfig(path.Join(dir, "missing.yaml")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("readConfig of a missing file = %v, want not exist", err)
+	}
+}
+
+func TestImportConfig(t *testing.T) {
+	dir := t.TempDir()
+	pref, err := openPreferences(path.Join(dir, "preferences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setArchiveRoot(pref, path.Join(dir, "DeskClean"))
+	pref.SetString("CollisionPolicy", string(collisionNumber))
+	pref.SetString("NotifyPolicy", string(notifyErrors))
+
+	tests := []struct {
+		name     string
+		settings map[string]any
+		err      string
+	}{
+		{"unknown setting", map[string]any{"CollisionPolicy": "skip", "LastSweep": "now"}, "unknown setting"},
+		{"bad choice", map[string]any{"CollisionPolicy": "skip", "NotifyPolicy": "sometimes"}, "NotifyPolicy"},
+		{"negative number", map[string]any{"CollisionPolicy": "skip", "RetentionKeepDays": -1}, "0 or more"},
+		{"fraction", map[string]any{"CollisionPolicy": "skip", "RetentionKeepDays": 1.5}, "whole number"},
+		{"text for a number", map[string]any{"CollisionPolicy": "skip", "BundleAfterDays": "ten"}, "expected a number"},
+		{"text for a list", map[string]any{"CollisionPolicy": "skip", "Rules": "*.tmp -> delete"}, "expected a list"},
+		{"bad rule", map[string]any{"CollisionPolicy": "skip", "Rules": []any{"*.tmp"}}, "Rules"},
+		{"bad schedule", map[string]any{"CollisionPolicy": "skip", "Profiles": []any{map[string]any{"name": "Desktop", "sourcePath": dir, "label": "Archive", "dateScheme": "2006-01-02", "schedule": "every so often"}}}, "schedule"},
+	}
+	for _, tt := range tests {
+		err := importConfig(pref, configDocument{Version: configVersion, Settings: tt.settings})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: importConfig error = %v, want one containing %q", tt.name, err, tt.err)
+		}
+		// Nothing is stored unless every setting is valid
+		if v := pref.String("CollisionPolicy"); v != string(collisionNumber) {
+			t.Fatalf("%s: CollisionPolicy = %q after a failed import, want it unchanged", tt.name, v)
+		}
+	}
+
+	err = importConfig(pref, configDocument{Version: configVersion, Settings: map[string]any{
+		"CollisionPolicy":   "skip",
+		"RetentionKeepDays": float64(30),
+		"Rules":             []any{"*.tmp -> delete"},
+		"Profiles":          []any{map[string]any{"name": "Desktop", "sourcePath": "~/Desktop", "label": "Archive", "dateScheme": "2006-01-02", "runInterval": "every hour"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := pref.String("CollisionPolicy"); v != "skip" {
+		t.Errorf("CollisionPolicy = %q, want skip", v)
+	}
+	if v := pref.Int("RetentionKeepDays"); v != 30 {
+		t.Errorf("RetentionKeepDays = %d, want 30", v)
+	}
+	if v := pref.StringList("Rules"); len(v) != 1 || v[0] != "*.tmp -> delete" {
+		t.Errorf("Rules = %q, want the imported rule", v)
+	}
+	if v := pref.String("NotifyPolicy"); v != string(notifyErrors) {
+		t.Errorf("NotifyPolicy = %q, want the setting left out kept", v)
+	}
+	profiles := loadProfiles(pref)
+	if len(profiles) != 1 || profiles[0].SourcePath != path.Join(xdg.Home, "Desktop") || profiles[0].Schedule != "0 * * * *" || profiles[0].RunInterval != "" {
+		t.Errorf("profiles = %+v, want the home expanded and the run interval made a schedule", profiles)
+	}
+}
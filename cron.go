@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const scheduleOnDemand string = "on demand"
+
+// schedulePresets are offered in the settings UI, any other cron spec can be typed in.
+var schedulePresets = []string{scheduleOnDemand, runOnChange, "*/15 * * * *", "0 * * * *", "0 */4 * * *", "0 9 * * *", "0 18 * * 1-5", "@daily", "@weekly"}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField is one of the five fields of a cron spec.
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}},
+	// 7 is accepted for Sunday as well as 0
+	{name: "day of week", min: 0, max: 7, names: map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}},
+}
+
+// cronSchedule is a parsed five field cron spec: minute, hour, day of month,
+// month and day of week. Each field is a bit set of the values it allows.
+type cronSchedule struct {
+	fields [5]uint64
+	// With both day fields restricted a day matches either, as in cron(8)
+	domStar bool
+	dowStar bool
+}
+
+func parseCron(spec string) (cronSchedule, error) {
+	c := cronSchedule{}
+	spec = strings.TrimSpace(spec)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return c, fmt.Errorf("cron spec needs 5 fields (minute hour day month weekday), got %d", len(parts))
+	}
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return c, err
+		}
+		c.fields[i] = bits
+	}
+	// Fold Sunday as 7 onto 0
+	if c.fields[4]&(1<<7) != 0 {
+		c.fields[4] |= 1
+	}
+	c.domStar = strings.HasPrefix(parts[2], "*")
+	c.dowStar = strings.HasPrefix(parts[4], "*")
+	return c, nil
+}
+
+func parseCronField(text string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(strings.ToLower(text), ",") {
+		rng, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepText, f.name)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			loText, hiText, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(loText); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(hiText); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "5/15" means from 5 to the end in steps of 15
+				hi = f.max
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid range %q in %s field", rng, f.name)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(text string) (int, error) {
+	if v, ok := f.names[text]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q in %s field, expected %d-%d", text, f.name, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (c cronSchedule) has(field, v int) bool {
+	return c.fields[field]&(1<<uint(v)) != 0
+}
+
+func (c cronSchedule) matchesDay(t time.Time) bool {
+	dom := c.has(2, t.Day())
+	dow := c.has(4, int(t.Weekday()))
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first time after t that the schedule fires.
+func (c cronSchedule) next(t time.Time) (time.Time, error) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Five years covers every valid spec, including 29 February on a weekday
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.has(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.has(1, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.has(0, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("schedule never fires")
+}
+
+// intervalToCron converts the fixed run intervals of older versions to the
+// equivalent cron spec.
+func intervalToCron(text string) string {
+	switch text {
+	case "every minute":
+		return "* * * * *"
+	case "every 5 minutes":
+		return "*/5 * * * *"
+	case "every 15 minutes":
+		return "*/15 * * * *"
+	case "every 30 minutes":
+		return "*/30 * * * *"
+	case "every hour", "every 60 minutes":
+		return "0 * * * *"
+	case "every 4 hours":
+		return "0 */4 * * *"
+	case "every 12 hours":
+		return "0 */12 * * *"
+	case "every 24 hours":
+		return "0 0 * * *"
+	case runOnChange:
+		return runOnChange
+	default:
+		return scheduleOnDemand
+	}
+}
+
+// describeSchedule explains when a schedule next runs, for display in settings.
+func describeSchedule(spec string, now time.Time) (string, error) {
+	switch spec {
+	case scheduleOnDemand:
+		return "Only swept from the tray menu.", nil
+	case runOnChange:
+		return "Swept as soon as items stop changing.", nil
+	}
+	c, err := parseCron(spec)
+	if err != nil {
+		return "", err
+	}
+	runs := []string{}
+	t := now
+	for i := 0; i < 3; i++ {
+		if t, err = c.next(t); err != nil {
+			return "", err
+		}
+		runs = append(runs, t.Format("Mon Jan 2 15:04"))
+	}
+	return "Next runs: " + strings.Join(runs, ", "), nil
+}
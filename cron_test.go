@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		ok   bool
+	}{
+		{"* * * * *", true},
+		{"@daily", true},
+		{"@HOURLY", true},
+		{"0 18 * * mon-fri", true},
+		{"0 0 1 jan,jul *", true},
+		{"*/15 * * * *", true},
+		{"5/15 * * * *", true},
+		{"10-40/10 * * * *", true},
+		{"0 0 * * 7", true},
+		{"", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"30-10 * * * *", false},
+		{"*/0 * * * *", false},
+		{"*/x * * * *", false},
+		{"1-5-7 * * * *", false},
+		{"* * * foo *", false},
+		{"@fortnightly", false},
+	}
+	for _, tt := range tests {
+		_, err := parseCron(tt.spec)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseCron(%q) error = %v, want ok %v", tt.spec, err, tt.ok)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2026, time.January, 14, 10, 7, 30, 0, time.UTC)
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		spec string
+		want time.Time
+	}{
+		{"every minute", "* * * * *", at(time.January, 14, 10, 8)},
+		{"step", "*/15 * * * *", at(time.January, 14, 10, 15)},
+		{"step from a start", "5/20 * * * *", at(time.January, 14, 10, 25)},
+		{"step over a range", "10-40/15 * * * *", at(time.January, 14, 10, 10)},
+		{"step over a range wraps to the next hour", "10-40/15 11 * * *", at(time.January, 14, 11, 10)},
+		{"list", "0,45 * * * *", at(time.January, 14, 10, 45)},
+		{"hourly", "@hourly", at(time.January, 14, 11, 0)},
+		{"daily", "@daily", at(time.January, 15, 0, 0)},
+		{"weekly on Sunday", "@weekly", at(time.January, 18, 0, 0)},
+		{"Sunday as 7", "0 0 * * 7", at(time.January, 18, 0, 0)},
+		{"weekday names", "0 9 * * sat,sun", at(time.January, 17, 9, 0)},
+		{"weekdays", "0 18 * * 1-5", at(time.January, 14, 18, 0)},
+		{"month name", "0 0 1 mar *", at(time.March, 1, 0, 0)},
+		{"day of month only", "0 0 20 * *", at(time.January, 20, 0, 0)},
+		// With both day fields restricted either one matching is enough
+		{"day of month or day of week", "0 0 20 * fri", at(time.January, 16, 0, 0)},
+		{"day of week or day of month", "0 0 15 * mon", at(time.January, 15, 0, 0)},
+		// As in cron(8) a field starting with * counts as unrestricted, so both must match
+		{"starred day of month with a step", "0 0 */10 * fri", at(time.May, 1, 0, 0)},
+		{"end of month skips short months", "0 0 31 feb-apr *", at(time.March, 31, 0, 0)},
+		{"same minute is not repeated", "7 10 * * *", at(time.January, 15, 10, 7)},
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: parseCron(%q): %v", tt.name, tt.spec, err)
+		}
+		got, err := c.next(from)
+		if err != nil {
+			t.Errorf("%s: next: %v", tt.name, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: next(%q) = %v, want %v", tt.name, tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextLeapDay(t *testing.T) {
+	c, err := parseCron("0 12 29 feb *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.next(time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2028, time.February, 29, 12, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("next = %v, want %v", got, want)
+	}
+
+	c, err = parseCron("0 0 30 feb *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.next(time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("next of 30 February should fail")
+	}
+}
+
+func TestIntervalToCron(t *testing.T) {
+	tests := map[string]string{
+		"every 15 minutes": "*/15 * * * *",
+		"every hour":       "0 * * * *",
+		"every 60 minutes": "0 * * * *",
+		"every 24 hours":   "0 0 * * *",
+		"on change":        runOnChange,
+		"on demand":        scheduleOnDemand,
+		"whenever":         scheduleOnDemand,
+	}
+	for interval, want := range tests {
+		if got := intervalToCron(interval); got != want {
+			t.Errorf("intervalToCron(%q) = %q, want %q", interval, got, want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// daemonCommand runs every profile on its schedule without a display until it
+// is stopped. SIGHUP reloads the preferences and reschedules the profiles. The
+// install, uninstall and units subcommands manage systemd user units for it.
+func daemonCommand(pref *filePreferences, appName string, args []string) int {
+	if len(args) > 0 {
+		return daemonUnitsCommand(appName, args)
+	}
+
+	slog.SetDefault(newLogger(appName))
+	var current atomic.Pointer[filePreferences]
+	current.Store(pref)
+	sweep := func(p sweepProfile, only []string, trigger sweepTrigger) {
+		pref := current.Load()
+		plan, err := runSweep(pref, appName, p, only, trigger)
+		if err != nil {
+			slog.Error("Failed to sweep source files.", slog.Any("error", err), slog.String("profile", p.Name))
+		}
+		notifySweep(pref, p, plan, err, func(n *fyne.Notification) {
+			if err := sendDesktopNotification(appName, n.Title, n.Content); err != nil {
+				slog.Debug("Unable to send notification.", slog.Any("error", err))
+			}
+		})
+		go enforceRetention(pref, appName)
+		pref.SetString("LastSweep", time.Now().Format(lastSweepStamp))
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	slog.Info("Sweeper daemon started.")
+	stop := scheduleProfiles(loadProfiles(pref), sweep)
+	for sig := range signals {
+		close(stop)
+		if sig != syscall.SIGHUP {
+			break
+		}
+		reloaded, err := loadPreferences(pref.file)
+		if err != nil {
+			slog.Error("Unable to reload preferences.", slog.Any("error", err))
+		} else {
+			// Wait for a running sweep to finish with the old preferences
+			sweepLock.Lock()
+			pref = reloaded
+			current.Store(reloaded)
+			sweepLock.Unlock()
+			slog.Info("Reloaded preferences.")
+		}
+		stop = scheduleProfiles(loadProfiles(pref), sweep)
+	}
+	slog.Info("Sweeper daemon stopped.")
+	return exitOK
+}
+
+func daemonUnitsCommand(appName string, args []string) int {
+	fs := newFlagSet("daemon " + args[0])
+	onCalendar := fs.String("timer", "", "sweep from a systemd timer at these times, e.g. "+defaultOnCalendar+", instead of running the daemon")
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	if runtime.GOOS != "linux" {
+		fmt.Fprintln(os.Stderr, "systemd units are only supported on Linux.")
+		return exitFailed
+	}
+	exe, err := getAppExecutable(runtime.GOOS, appName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to determine app executable:", err)
+		return exitFailed
+	}
+	units := daemonUnits(exe, appName, *onCalendar)
+
+	switch args[0] {
+	case "units":
+		for _, u := range units {
+			fmt.Printf("# %s\n%s\n", u.Name, u.Contents)
+		}
+		return exitOK
+	case "install":
+		// Only one of the daemon and the timer should sweep
+		if err := uninstallUnits(true, daemonUnitName, sweepTimerName, sweepUnitName); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to remove existing units:", err)
+			return exitFailed
+		}
+		enable := units[len(units)-1].Name
+		if err := installUnits(units, enable, true); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to install units:", err)
+			return exitFailed
+		}
+		fmt.Printf("Installed and started %s in %s\n", enable, getUnitDir())
+		return exitOK
+	case "uninstall":
+		if err := uninstallUnits(true, daemonUnitName, sweepTimerName, sweepUnitName); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to remove units:", err)
+			return exitFailed
+		}
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown daemon command %q.\n\n%s", args[0], cliUsage)
+		return exitUsage
+	}
+}
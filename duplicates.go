@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"lukechampine.com/blake3"
+)
+
+// duplicatePolicy decides what a sweep does with a file whose content is
+// already in the archive.
+type duplicatePolicy string
+
+const (
+	duplicateOff      duplicatePolicy = "off"
+	duplicateSkip     duplicatePolicy = "skip"
+	duplicateHardLink duplicatePolicy = "hard link"
+	duplicateMove     duplicatePolicy = "move to Duplicates"
+
+	duplicateFolder string = "Duplicates"
+	hashIndexFile   string = "hashes.json"
+)
+
+type hashAlgorithm string
+
+const (
+	hashSHA256 hashAlgorithm = "sha256"
+	hashBLAKE3 hashAlgorithm = "blake3"
+)
+
+var (
+	allowedDuplicatePolicies = []string{string(duplicateOff), string(duplicateSkip), string(duplicateHardLink), string(duplicateMove)}
+	allowedHashAlgorithms    = []string{string(hashSHA256), string(hashBLAKE3)}
+)
+
+func newHash(alg hashAlgorithm) hash.Hash {
+	if alg == hashBLAKE3 {
+		return blake3.New(32, nil)
+	}
+	return sha256.New()
+}
+
+func hashReader(alg hashAlgorithm, r io.Reader) (string, error) {
+	h := newHash(alg)
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type hashedFile struct {
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// hashIndex remembers the content hash of every file swept into the archive so
+// incoming files can be recognised as duplicates without rereading the archive.
+type hashIndex struct {
+	Algorithm hashAlgorithm         `json:"algorithm"`
+	Files     map[string]hashedFile `json:"files"`
+
+	file   string
+	byHash map[string][]string
+}
+
+// loadHashIndex reads the index from file. A missing index, or one made with
+// another algorithm, is rebuilt from the files already in archiveRoot.
+func loadHashIndex(file string, alg hashAlgorithm, archiveRoot string) (*hashIndex, error) {
+	idx := &hashIndex{file: file}
+	data, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, idx); err != nil {
+			slog.Warn("Unable to read hash index, rebuilding it.", slog.Any("error", err), slog.String("file", file))
+		}
+	}
+	if idx.Algorithm == alg && idx.Files != nil {
+		idx.byHash = map[string][]string{}
+		for p, f := range idx.Files {
+			idx.byHash[f.Hash] = append(idx.byHash[f.Hash], p)
+		}
+		return idx, nil
+	}
+
+	idx.Algorithm = alg
+	idx.Files = map[string]hashedFile{}
+	idx.byHash = map[string][]string{}
+	if err := idx.scan(archiveRoot); err != nil {
+		return nil, err
+	}
+	slog.Info("Built hash index of the archive.", slog.Int("fileCount", len(idx.Files)), slog.String("algorithm", string(alg)))
+	return idx, idx.save()
+}
+
+// scan hashes every regular file under root, passing over bundles and any
+// half written copies.
+func (idx *hashIndex) scan(root string) error {
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if !d.Type().IsRegular() || strings.HasPrefix(name, partialPrefix) || strings.HasSuffix(name, bundleIndexExt) {
+			return nil
+		}
+		if _, _, isBundle := bundleFormatOf(name); isBundle {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		sum, err := hashReader(idx.Algorithm, f)
+		if err != nil {
+			return err
+		}
+		idx.add(filepath.ToSlash(p), hashedFile{Hash: sum, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (idx *hashIndex) add(p string, f hashedFile) {
+	idx.Files[p] = f
+	idx.byHash[f.Hash] = append(idx.byHash[f.Hash], p)
+}
+
+// lookup returns an archived file with the given content that is still in
+// place and unchanged since it was indexed.
+func (idx *hashIndex) lookup(sum string, size int64) (string, bool) {
+	for _, p := range idx.byHash[sum] {
+		f := idx.Files[p]
+		info, err := os.Lstat(p)
+		if err != nil || !info.Mode().IsRegular() || info.Size() != size || f.Size != size || !info.ModTime().Equal(f.ModTime) {
+			continue
+		}
+		return p, true
+	}
+	return "", false
+}
+
+// save writes the index, dropping files that are no longer in the archive.
+func (idx *hashIndex) save() error {
+	for p := range idx.Files {
+		if !exists(p) {
+			delete(idx.Files, p)
+		}
+	}
+	if err := os.MkdirAll(path.Dir(idx.file), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmp := idx.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.file)
+}
+
+// findDuplicate hashes a file the plan moves and, when the archive or an earlier
+// entry of the plan already holds the same content, applies the duplicate policy.
+func findDuplicate(fsys fs.FS, p string, d fs.DirEntry, m *plannedMove, opts sweepOptions, seen map[string]string) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	f, err := fsys.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if m.Hash, err = hashReader(opts.Hashes.Algorithm, f); err != nil {
+		return err
+	}
+	m.Size = info.Size()
+
+	original, ok := seen[m.Hash]
+	if !ok {
+		original, ok = opts.Hashes.lookup(m.Hash, m.Size)
+	}
+	if !ok {
+		return nil
+	}
+	m.DuplicateOf = original
+	switch opts.Duplicates {
+	case duplicateSkip:
+		m.Action = actionSkip
+		m.SkipReason = "duplicate"
+		m.Destination = ""
+	case duplicateMove:
+		m.Destination = path.Join(opts.ArchiveRoot, duplicateFolder, path.Base(p))
+	}
+	return nil
+}
+
+// linkDuplicate puts a hard link to the archived copy at dst and removes src.
+// When the archive cannot hold a link to it the file is moved as usual.
+func linkDuplicate(src, dst, original string) (bool, error) {
+	if err := os.Link(original, dst); err != nil {
+		slog.Debug("Unable to hard link duplicate, moving it.", slog.Any("error", err), slog.String("file", src))
+		return false, moveFile(src, dst)
+	}
+	if err := os.Remove(src); err != nil {
+		os.Remove(dst)
+		return false, err
+	}
+	return true, nil
+}
+
+// loadSweepHashes opens the hash index when duplicate detection is on.
+func loadSweepHashes(pref fyne.Preferences, appName string) (*hashIndex, error) {
+	if duplicatePolicy(pref.StringWithFallback("DuplicatePolicy", string(duplicateOff))) == duplicateOff {
+		return nil, nil
+	}
+	alg := hashAlgorithm(pref.StringWithFallback("DuplicateHash", string(hashSHA256)))
+	archiveRoot := getArchiveRoot(pref)
+	return loadHashIndex(path.Join(getDataDir(appName), hashIndexFile), alg, archiveRoot)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// dateBasis selects which date names the archive folder an item is swept into.
+type dateBasis string
+
+const (
+	dateBasisSweep    dateBasis = "sweep time"
+	dateBasisModified dateBasis = "modified"
+	dateBasisCreated  dateBasis = "created"
+	dateBasisContent  dateBasis = "content"
+
+	exifDateStamp string = "2006:01:02 15:04:05"
+	// metadataLimit caps how much of a file is read looking for its dates
+	metadataLimit int64 = 1 << 20
+)
+
+var allowedDateBases = []string{string(dateBasisSweep), string(dateBasisModified), string(dateBasisCreated), string(dateBasisContent)}
+
+// fileDate returns the date of the entry p of fsys, found at source on disk,
+// for the basis. Dates that are not known fall back to the creation time and
+// then to the modification time.
+func fileDate(fsys fs.FS, source, p string, info fs.FileInfo, basis dateBasis) time.Time {
+	if basis == dateBasisContent && info.Mode().IsRegular() {
+		if t, ok := contentDate(fsys, p); ok {
+			return t
+		}
+	}
+	if basis == dateBasisContent || basis == dateBasisCreated {
+		if t, ok := birthTime(source, info); ok {
+			return t
+		}
+	}
+	return info.ModTime()
+}
+
+// contentDate reads the date a photo was taken from its EXIF data, or the date
+// a PDF was created from its metadata.
+func contentDate(fsys fs.FS, p string) (time.Time, bool) {
+	f, err := fsys.Open(p)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.LimitReader(f, metadataLimit))
+	head, err := r.Peek(4)
+	if err != nil {
+		return time.Time{}, false
+	}
+	switch {
+	case head[0] == 0xff && head[1] == 0xd8:
+		return jpegDate(r)
+	case bytes.Equal(head, []byte("II*\x00")) || bytes.Equal(head, []byte("MM\x00*")):
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return exifDate(data)
+	case bytes.Equal(head, []byte("%PDF")):
+		return pdfDate(f, r)
+	}
+	return time.Time{}, false
+}
+
+// jpegDate finds the EXIF segment among the JPEG markers before the image data.
+func jpegDate(r *bufio.Reader) (time.Time, bool) {
+	if _, err := r.Discard(2); err != nil {
+		return time.Time{}, false
+	}
+	for {
+		marker := make([]byte, 4)
+		if _, err := io.ReadFull(r, marker); err != nil || marker[0] != 0xff {
+			return time.Time{}, false
+		}
+		// Start of scan, the metadata comes before it
+		if marker[1] == 0xda {
+			return time.Time{}, false
+		}
+		size := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if size < 0 {
+			return time.Time{}, false
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return time.Time{}, false
+		}
+		if marker[1] == 0xe1 && bytes.HasPrefix(data, []byte("Exif\x00\x00")) {
+			return exifDate(data[6:])
+		}
+	}
+}
+
+// exifDate reads DateTimeOriginal, DateTimeDigitized or DateTime, in that
+// order, from TIFF formatted EXIF data. EXIF dates carry no zone and are taken
+// as local time.
+func exifDate(data []byte) (time.Time, bool) {
+	if len(data) < 8 {
+		return time.Time{}, false
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if data[0] == 'M' {
+		order = binary.BigEndian
+	}
+
+	// tags reads the entries of the IFD at offset, keeping the values of want
+	tags := func(offset uint32, want ...uint16) map[uint16]uint32 {
+		found := map[uint16]uint32{}
+		if int64(offset)+2 > int64(len(data)) {
+			return found
+		}
+		count := int(order.Uint16(data[offset:]))
+		for i := 0; i < count; i++ {
+			at := int64(offset) + 2 + int64(i)*12
+			if at+12 > int64(len(data)) {
+				break
+			}
+			tag := order.Uint16(data[at:])
+			for _, w := range want {
+				if tag == w {
+					found[tag] = order.Uint32(data[at+8:])
+				}
+			}
+		}
+		return found
+	}
+	// stamp parses the ASCII date stored at offset
+	stamp := func(offset uint32) (time.Time, bool) {
+		end := int64(offset) + int64(len(exifDateStamp))
+		if end > int64(len(data)) {
+			return time.Time{}, false
+		}
+		t, err := time.ParseInLocation(exifDateStamp, string(data[offset:end]), time.Local)
+		return t, err == nil
+	}
+
+	ifd0 := tags(order.Uint32(data[4:]), 0x0132, 0x8769)
+	if sub, ok := ifd0[0x8769]; ok {
+		exif := tags(sub, 0x9003, 0x9004)
+		for _, tag := range []uint16{0x9003, 0x9004} {
+			if offset, ok := exif[tag]; ok {
+				if t, ok := stamp(offset); ok {
+					return t, true
+				}
+			}
+		}
+	}
+	if offset, ok := ifd0[0x0132]; ok {
+		return stamp(offset)
+	}
+	return time.Time{}, false
+}
+
+var (
+	pdfCreationDate = regexp.MustCompile(`/CreationDate\s*\(D:(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?(?:([Z+\-])(\d{2})?'?(\d{2})?)?`)
+	xmpCreateDate   = regexp.MustCompile(`xmp:CreateDate(?:>|=")([0-9T:.+\-Z]+)`)
+)
+
+// pdfDate looks for the CreationDate of the document information dictionary,
+// or the XMP CreateDate, at the start and at the end of the PDF where writers
+// put them.
+func pdfDate(f fs.File, r io.Reader) (time.Time, bool) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if s, ok := f.(io.Seeker); ok && int64(len(data)) == metadataLimit {
+		if _, err := s.Seek(-metadataLimit, io.SeekEnd); err == nil {
+			if tail, err := io.ReadAll(io.LimitReader(f, metadataLimit)); err == nil {
+				data = append(data, tail...)
+			}
+		}
+	}
+
+	if m := pdfCreationDate.FindSubmatch(data); m != nil {
+		num := func(i, fallback int) int {
+			if n, err := strconv.Atoi(string(m[i])); err == nil {
+				return n
+			}
+			return fallback
+		}
+		loc := time.Local
+		switch string(m[7]) {
+		case "Z":
+			loc = time.UTC
+		case "+", "-":
+			offset := num(8, 0)*3600 + num(9, 0)*60
+			if string(m[7]) == "-" {
+				offset = -offset
+			}
+			loc = time.FixedZone("", offset)
+		}
+		t := time.Date(num(1, 0), time.Month(num(2, 1)), num(3, 1), num(4, 0), num(5, 0), num(6, 0), 0, loc)
+		return t, true
+	}
+	if m := xmpCreateDate.FindSubmatch(data); m != nil {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+			if t, err := time.ParseInLocation(layout, string(m[1]), time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
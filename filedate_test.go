@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// exifTIFF builds TIFF formatted EXIF data with DateTime in IFD0 and
+// DateTimeOriginal in the EXIF IFD, leaving out the empty ones.
+func exifTIFF(order binary.ByteOrder, dateTime, original string) []byte {
+	var head, data bytes.Buffer
+	if order == binary.BigEndian {
+		head.WriteString("MM\x00*")
+	} else {
+		head.WriteString("II*\x00")
+	}
+	binary.Write(&head, order, uint32(8))
+
+	count := 0
+	if dateTime != "" {
+		count++
+	}
+	if original != "" {
+		count++
+	}
+	ifd0End := 8 + 2 + 12*count + 4
+	subEnd := ifd0End
+	if original != "" {
+		subEnd += 2 + 12 + 4
+	}
+	entry := func(w *bytes.Buffer, tag, kind uint16, n, value uint32) {
+		binary.Write(w, order, tag)
+		binary.Write(w, order, kind)
+		binary.Write(w, order, n)
+		binary.Write(w, order, value)
+	}
+
+	offset := uint32(subEnd)
+	binary.Write(&head, order, uint16(count))
+	if dateTime != "" {
+		entry(&head, 0x0132, 2, uint32(len(dateTime)+1), offset)
+		data.WriteString(dateTime + "\x00")
+		offset += uint32(len(dateTime) + 1)
+	}
+	if original != "" {
+		entry(&head, 0x8769, 4, 1, uint32(ifd0End))
+	}
+	binary.Write(&head, order, uint32(0))
+	if original != "" {
+		binary.Write(&head, order, uint16(1))
+		entry(&head, 0x9003, 2, uint32(len(original)+1), offset)
+		binary.Write(&head, order, uint32(0))
+		data.WriteString(original + "\x00")
+	}
+	return append(head.Bytes(), data.Bytes()...)
+}
+
+// jpegWithExif wraps EXIF data in an APP1 segment after an unrelated APP0.
+func jpegWithExif(exif []byte) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0xff, 0xd8})
+	b.Write([]byte{0xff, 0xe0, 0x00, 0x06})
+	b.WriteString("JFIF")
+	app1 := append([]byte("Exif\x00\x00"), exif...)
+	b.Write([]byte{0xff, 0xe1})
+	binary.Write(&b, binary.BigEndian, uint16(len(app1)+2))
+	b.Write(app1)
+	b.Write([]byte{0xff, 0xda, 0x00, 0x02})
+	return b.Bytes()
+}
+
+func TestExifDate(t *testing.T) {
+	local := func(y int, m time.Month, d, h, min, s int) time.Time {
+		return time.Date(y, m, d, h, min, s, 0, time.Local)
+	}
+	valid := exifTIFF(binary.LittleEndian, "", "2024:07:01 08:09:10")
+	tests := []struct {
+		name string
+		data []byte
+		want time.Time
+		ok   bool
+	}{
+		{"original, little endian", valid, local(2024, time.July, 1, 8, 9, 10), true},
+		{"original, big endian", exifTIFF(binary.BigEndian, "", "2023:01:02 03:04:05"), local(2023, time.January, 2, 3, 4, 5), true},
+		{"original wins over DateTime", exifTIFF(binary.LittleEndian, "2020:01:01 00:00:00", "2021:02:03 04:05:06"), local(2021, time.February, 3, 4, 5, 6), true},
+		{"DateTime only", exifTIFF(binary.BigEndian, "2020:05:06 07:08:09", ""), local(2020, time.May, 6, 7, 8, 9), true},
+		{"no dates", exifTIFF(binary.LittleEndian, "", ""), time.Time{}, false},
+		{"malformed date", exifTIFF(binary.LittleEndian, "not a date at all!!", ""), time.Time{}, false},
+		{"too short", []byte("II*\x00"), time.Time{}, false},
+		{"truncated", valid[:20], time.Time{}, false},
+		{"IFD offset past the end", append([]byte("II*\x00"), 0xff, 0xff, 0xff, 0x7f), time.Time{}, false},
+		{"entry count past the end", append([]byte("II*\x00\x08\x00\x00\x00"), 0xff, 0xff), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := exifDate(tt.data)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("%s: exifDate = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPDFDate(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want time.Time
+		ok   bool
+	}{
+		{"UTC", "%PDF-1.7\n<< /CreationDate (D:20240102030405Z) >>", time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC), true},
+		{"offset", "%PDF-1.4\n/CreationDate(D:20240102030405+02'00')", time.Date(2024, time.January, 2, 1, 4, 5, 0, time.UTC), true},
+		{"negative offset", "%PDF-1.4\n/CreationDate (D:20240102030405-05'30)", time.Date(2024, time.January, 2, 8, 34, 5, 0, time.UTC), true},
+		{"date only", "%PDF-1.4\n/CreationDate (D:2024)", time.Date(2024, time.January, 1, 0, 0, 0, 0, time.Local), true},
+		{"XMP", `%PDF-1.6 <xmp:CreateDate>2022-03-04T05:06:07Z</xmp:CreateDate>`, time.Date(2022, time.March, 4, 5, 6, 7, 0, time.UTC), true},
+		{"XMP attribute", `%PDF-1.6 xmp:CreateDate="2022-03-04"`, time.Date(2022, time.March, 4, 0, 0, 0, 0, time.Local), true},
+		{"malformed XMP", `%PDF-1.6 <xmp:CreateDate>2022-99</xmp:CreateDate>`, time.Time{}, false},
+		{"no dates", "%PDF-1.4\n<< /Title (x) >>", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		fsys := fstest.MapFS{"doc.pdf": {Data: []byte(tt.data)}}
+		got, ok := contentDate(fsys, "doc.pdf")
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("%s: contentDate = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestContentDate(t *testing.T) {
+	taken := time.Date(2024, time.July, 1, 8, 9, 10, 0, time.Local)
+	exif := exifTIFF(binary.LittleEndian, "", "2024:07:01 08:09:10")
+	badSegment := []byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x01}
+	fsys := fstest.MapFS{
+		"photo.jpg":     {Data: jpegWithExif(exif)},
+		"scan.tif":      {Data: exif},
+		"plain.jpg":     {Data: []byte{0xff, 0xd8, 0xff, 0xda, 0x00, 0x02}},
+		"bad.jpg":       {Data: badSegment},
+		"truncated.jpg": {Data: jpegWithExif(exif)[:30]},
+		"notes.txt":     {Data: []byte("2024:07:01 08:09:10")},
+		"tiny":          {Data: []byte("a")},
+	}
+	tests := []struct {
+		name string
+		want time.Time
+		ok   bool
+	}{
+		{"photo.jpg", taken, true},
+		{"scan.tif", taken, true},
+		{"plain.jpg", time.Time{}, false},
+		{"bad.jpg", time.Time{}, false},
+		{"truncated.jpg", time.Time{}, false},
+		{"notes.txt", time.Time{}, false},
+		{"tiny", time.Time{}, false},
+		{"missing.jpg", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := contentDate(fsys, tt.name)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("contentDate(%q) = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFileDateFallback(t *testing.T) {
+	modified := time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{"notes.txt": {Data: []byte("hello"), ModTime: modified}}
+	info, err := fsys.Stat("notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No content date and no file on disk to read a creation time from
+	for _, basis := range []dateBasis{dateBasisModified, dateBasisCreated, dateBasisContent} {
+		if got := fileDate(fsys, "/nonexistent/notes.txt", "notes.txt", info, basis); !got.Equal(modified) {
+			t.Errorf("fileDate(%s) = %v, want the modification time %v", basis, got, modified)
+		}
+	}
+}
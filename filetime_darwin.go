@@ -0,0 +1,24 @@
+package main
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// changeTime returns the inode change time of the file, or its modification
+// time when that is not available.
+func changeTime(info fs.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Ctimespec.Unix())
+	}
+	return info.ModTime()
+}
+
+// birthTime returns when the file was created.
+func birthTime(_ string, info fs.FileInfo) (time.Time, bool) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Birthtimespec.Unix()), true
+	}
+	return time.Time{}, false
+}
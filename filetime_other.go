@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import (
+	"io/fs"
+	"time"
+)
+
+// changeTime falls back to the modification time where the change time is not known.
+func changeTime(info fs.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// birthTime is not known on these systems.
+func birthTime(string, fs.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// changeTime returns the creation time of the file, which is the closest
+// Windows has to a change time, or its modification time when that is not available.
+func changeTime(info fs.FileInfo) time.Time {
+	if attr, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return time.Unix(0, attr.CreationTime.Nanoseconds())
+	}
+	return info.ModTime()
+}
+
+// birthTime returns when the file was created.
+func birthTime(_ string, info fs.FileInfo) (time.Time, bool) {
+	if attr, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return time.Unix(0, attr.CreationTime.Nanoseconds()), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+// sweepTrigger records what started a sweep run.
+type sweepTrigger string
+
+const (
+	triggerManual      sweepTrigger = "manual"
+	triggerSchedule    sweepTrigger = "schedule"
+	triggerFileEvent   sweepTrigger = "file event"
+	triggerCommandLine sweepTrigger = "command line"
+
+	historyStamp string = "2006-01-02 15:04:05"
+)
+
+// diskUsage returns the size of the file, or of everything inside the folder.
+func diskUsage(p string) int64 {
+	var size int64
+	filepath.WalkDir(p, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// formatBytes prints a size with the largest unit that keeps it above one.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// empty reports whether the run did nothing and nothing went wrong.
+func (m sweepManifest) empty() bool {
+	return len(m.Moves)+len(m.Trashed)+len(m.Deleted)+len(m.Failed) == 0 && m.Error == ""
+}
+
+// duration returns how long the run took, or zero for runs recorded before
+// the end time was kept.
+func (m sweepManifest) duration() time.Duration {
+	if m.FinishedAt == nil {
+		return 0
+	}
+	return m.FinishedAt.Sub(m.SweptAt).Round(time.Millisecond)
+}
+
+// summary describes the run on a single line.
+func (m sweepManifest) summary() string {
+	name := m.Profile
+	if m.Kind != "" {
+		name = "(" + m.Kind + ")"
+	}
+	s := fmt.Sprintf("%s  %s", m.SweptAt.Format(historyStamp), name)
+	if m.Trigger != "" {
+		s += ", " + string(m.Trigger)
+	}
+	s += fmt.Sprintf(": %d moved, %d skipped, %d failed, %s", len(m.Moves), m.Skipped, len(m.Failed), formatBytes(m.BytesMoved))
+	if m.Error != "" {
+		s += " (stopped: " + m.Error + ")"
+	}
+	if m.UndoneAt != nil {
+		s += " (undone)"
+	}
+	return s
+}
+
+// writeDetails prints everything recorded about the run, failures included.
+func (m sweepManifest) writeDetails(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID:\t%s\n", m.ID)
+	if m.Kind != "" {
+		fmt.Fprintf(tw, "Kind:\t%s\n", m.Kind)
+	} else {
+		fmt.Fprintf(tw, "Profile:\t%s\n", m.Profile)
+		fmt.Fprintf(tw, "Source:\t%s\n", m.SourcePath)
+		fmt.Fprintf(tw, "Target:\t%s\n", m.TargetPath)
+	}
+	if m.Trigger != "" {
+		fmt.Fprintf(tw, "Trigger:\t%s\n", m.Trigger)
+	}
+	fmt.Fprintf(tw, "Started:\t%s\n", m.SweptAt.Format(historyStamp))
+	if m.FinishedAt != nil {
+		fmt.Fprintf(tw, "Finished:\t%s (%s)\n", m.FinishedAt.Format(historyStamp), m.duration())
+	}
+	fmt.Fprintf(tw, "Moved:\t%d (%s)\n", len(m.Moves), formatBytes(m.BytesMoved))
+	fmt.Fprintf(tw, "Deleted:\t%d\n", len(m.Deleted))
+	fmt.Fprintf(tw, "Trashed:\t%d\n", len(m.Trashed))
+	fmt.Fprintf(tw, "Skipped:\t%d\n", m.Skipped)
+	fmt.Fprintf(tw, "Failed:\t%d\n", len(m.Failed))
+	fmt.Fprintf(tw, "Restored:\t%d\n", len(m.Restored))
+	if m.UndoneAt != nil {
+		fmt.Fprintf(tw, "Undone:\t%s\n", m.UndoneAt.Format(historyStamp))
+	}
+	if m.Error != "" {
+		fmt.Fprintf(tw, "Stopped:\t%s\n", m.Error)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(m.Failed) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tSOURCE\tERROR")
+	for _, f := range m.Failed {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Action, f.Source, f.Error)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+
+	"fyne.io/fyne/v2"
+)
+
+const ignoreFileName string = ".deskcleanignore"
+
+// ignorePattern keeps matching entries out of a sweep. Patterns from settings
+// are matched against the entry name and are either a /regex/, a glob, or an
+// exact name. Patterns from a .deskcleanignore file use gitignore syntax and are
+// matched against the path relative to the source.
+type ignorePattern struct {
+	Text     string
+	Origin   string
+	negate   bool
+	dirOnly  bool
+	fullPath bool
+	re       *regexp.Regexp
+	glob     string
+	exact    string
+}
+
+func (p ignorePattern) String() string {
+	return fmt.Sprintf("%s %s", p.Origin, p.Text)
+}
+
+// loadIgnorePatterns parses the patterns stored in preferences, skipping any that are invalid.
+func loadIgnorePatterns(pref fyne.Preferences) []ignorePattern {
+	patterns := []ignorePattern{}
+	for _, text := range pref.StringList("IgnorePatterns") {
+		p, err := parseIgnorePattern(text)
+		if err != nil {
+			slog.Warn("Ignoring invalid exclusion pattern.", slog.Any("error", err), slog.String("pattern", text))
+			continue
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+func parseIgnorePattern(text string) (ignorePattern, error) {
+	p := ignorePattern{Text: text, Origin: "settings"}
+	switch {
+	case len(text) > 2 && strings.HasPrefix(text, "/") && strings.HasSuffix(text, "/"):
+		re, err := regexp.Compile(text[1 : len(text)-1])
+		if err != nil {
+			return p, err
+		}
+		p.re = re
+	case strings.ContainsAny(text, `*?[\`):
+		if _, err := path.Match(text, ""); err != nil {
+			return p, fmt.Errorf("invalid glob %q: %w", text, err)
+		}
+		p.glob = text
+	case text == "":
+		return p, errors.New("empty pattern")
+	default:
+		p.exact = text
+	}
+	return p, nil
+}
+
+// readIgnoreFile parses the .deskcleanignore file at the root of fsys, if there is one.
+func readIgnoreFile(fsys fs.FS) ([]ignorePattern, error) {
+	data, err := fs.ReadFile(fsys, ignoreFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := []ignorePattern{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		p, err := parseGitignorePattern(text)
+		if err != nil {
+			slog.Warn("Ignoring invalid pattern in ignore file.", slog.Any("error", err), slog.String("pattern", text), slog.Int("line", line))
+			continue
+		}
+		p.Origin = fmt.Sprintf("%s:%d", ignoreFileName, line)
+		patterns = append(patterns, p)
+	}
+	return patterns, scanner.Err()
+}
+
+// parseGitignorePattern turns a single gitignore line into a regular expression
+// over slash separated paths relative to the source.
+func parseGitignorePattern(text string) (ignorePattern, error) {
+	p := ignorePattern{Text: text, fullPath: true}
+	pattern := text
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	// A slash anywhere but the end anchors the pattern to the source root
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return p, errors.New("empty pattern")
+	}
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/") && (i == 0 || pattern[i-1] == '/'):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**") && i+2 == len(pattern) && (i == 0 || pattern[i-1] == '/'):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				return p, fmt.Errorf("unterminated character class in %q", text)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return p, err
+	}
+	p.re = compiled
+	return p, nil
+}
+
+func (p ignorePattern) matches(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	name := path.Base(rel)
+	switch {
+	case p.exact != "":
+		return name == p.exact
+	case p.glob != "":
+		ok, _ := path.Match(p.glob, name)
+		return ok
+	case p.fullPath:
+		return p.re.MatchString(rel)
+	default:
+		return p.re.MatchString(name)
+	}
+}
+
+// matchIgnore returns the pattern that keeps rel out of the sweep. Settings
+// patterns win outright, ignore file patterns follow gitignore and let the last
+// matching line, which may be a negation, decide.
+func matchIgnore(rel string, isDir bool, settings, file []ignorePattern) (ignorePattern, bool) {
+	for _, p := range settings {
+		if p.matches(rel, isDir) {
+			return p, true
+		}
+	}
+
+	var last *ignorePattern
+	for i := range file {
+		if file[i].matches(rel, isDir) {
+			last = &file[i]
+		}
+	}
+	if last == nil || last.negate {
+		return ignorePattern{}, false
+	}
+	return *last, true
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseIgnorePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		isDir   bool
+		want    bool
+	}{
+		{"Thumbs.db", "Thumbs.db", false, true},
+		{"Thumbs.db", "thumbs.db", false, false},
+		{"*.tmp", "a.tmp", false, true},
+		{"*.tmp", "a.tmp.txt", false, false},
+		{"report-?.pdf", "report-1.pdf", false, true},
+		{"/^~\\$/", "~$draft.docx", false, true},
+		{"/^~\\$/", "draft.docx", false, false},
+		{"/\\.(iso|dmg)$/", "disk.dmg", false, true},
+	}
+	for _, tt := range tests {
+		p, err := parseIgnorePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("parseIgnorePattern(%q): %v", tt.pattern, err)
+		}
+		if got := p.matches(tt.name, tt.isDir); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "[a-", "/(/"} {
+		if _, err := parseIgnorePattern(bad); err == nil {
+			t.Errorf("parseIgnorePattern(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseGitignorePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "a.log", false, true},
+		{"*.log", "logs/a.log", false, true},
+		{"*.log", "a.log.txt", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"doc/*.txt", "doc/notes.txt", false, true},
+		{"doc/*.txt", "doc/old/notes.txt", false, false},
+		{"doc/*.txt", "src/doc/notes.txt", false, false},
+		{"**/cache", "cache", true, true},
+		{"**/cache", "a/b/cache", true, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**", "a/x/y", false, true},
+		{"a/**", "a", true, false},
+		{"file?.txt", "file1.txt", false, true},
+		{"file?.txt", "file/.txt", false, false},
+		{"[abc].txt", "b.txt", false, true},
+		{"[!abc].txt", "b.txt", false, false},
+		{"[!abc].txt", "d.txt", false, true},
+		{`\#notes`, "#notes", false, true},
+		{`\!important`, "!important", false, true},
+		{`star\*`, "star*", false, true},
+		{`star\*`, "stars", false, false},
+		{"a.b", "axb", false, false},
+	}
+	for _, tt := range tests {
+		p, err := parseGitignorePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("parseGitignorePattern(%q): %v", tt.pattern, err)
+		}
+		if got := p.matches(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("%q matches %q (dir %v) = %v, want %v", tt.pattern, tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"!", "/", "!/", "[abc"} {
+		if _, err := parseGitignorePattern(bad); err == nil {
+			t.Errorf("parseGitignorePattern(%q) should fail", bad)
+		}
+	}
+}
+
+func TestGitignoreNegation(t *testing.T) {
+	p, err := parseGitignorePattern("!keep/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.negate || !p.dirOnly {
+		t.Errorf("!keep/ = negate %v, dirOnly %v, want both", p.negate, p.dirOnly)
+	}
+	if !p.matches("keep", true) || p.matches("keep", false) {
+		t.Error("!keep/ should only match the folder keep")
+	}
+}
+
+func TestMatchIgnore(t *testing.T) {
+	fsys := fstest.MapFS{ignoreFileName: {Data: []byte(
+		"# comments and blank lines are skipped\n\n" +
+			"*.pdf\n" +
+			"!important.pdf\n" +
+			"projects/\n" +
+			"!projects/\n" +
+			"tmp/   \n" +
+			"[oops\n")}}
+	file, err := readIgnoreFile(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file) != 5 {
+		t.Fatalf("read %d patterns, want 5 with the invalid line skipped", len(file))
+	}
+	settings := []ignorePattern{}
+	if p, err := parseIgnorePattern("important.pdf"); err == nil {
+		settings = append(settings, p)
+	}
+
+	tests := []struct {
+		rel    string
+		isDir  bool
+		want   bool
+		origin string
+	}{
+		{"a.pdf", false, true, ignoreFileName + ":3"},
+		{"sub/a.pdf", false, true, ignoreFileName + ":3"},
+		// Settings win even over a negation in the file
+		{"important.pdf", false, true, "settings"},
+		// The last matching line decides
+		{"projects", true, false, ""},
+		{"tmp", true, true, ignoreFileName + ":7"},
+		{"tmp", false, false, ""},
+		{"a.txt", false, false, ""},
+	}
+	for _, tt := range tests {
+		p, got := matchIgnore(tt.rel, tt.isDir, settings, file)
+		if got != tt.want || p.Origin != tt.origin {
+			t.Errorf("matchIgnore(%q, %v) = %v from %q, want %v from %q", tt.rel, tt.isDir, got, p.Origin, tt.want, tt.origin)
+		}
+	}
+
+	none, err := readIgnoreFile(fstest.MapFS{})
+	if err != nil || none != nil {
+		t.Errorf("readIgnoreFile without a file = %v, %v, want nothing", none, err)
+	}
+}
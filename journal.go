@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// underSystemd reports whether the process was started by systemd, which
+// captures stderr into the journal.
+func underSystemd() bool {
+	return os.Getenv("INVOCATION_ID") != "" || os.Getenv("JOURNAL_STREAM") != ""
+}
+
+// journalHandler writes text records prefixed with their syslog priority, as
+// in sd-daemon(3), so the journal files each line under the right level. The
+// journal stamps every line itself so the time is left out.
+type journalHandler struct {
+	slog.Handler
+	buf *bytes.Buffer
+	mu  *sync.Mutex
+	out io.Writer
+}
+
+func newJournalHandler(out io.Writer, level slog.Leveler) journalHandler {
+	buf := &bytes.Buffer{}
+	return journalHandler{
+		Handler: slog.NewTextHandler(buf, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}),
+		buf: buf,
+		mu:  &sync.Mutex{},
+		out: out,
+	}
+}
+
+func (h journalHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf.Reset()
+	if err := h.Handler.Handle(ctx, r); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(h.out, "<%d>%s", journalPriority(r.Level), h.buf.Bytes())
+	return err
+}
+
+func (h journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h.Handler = h.Handler.WithAttrs(attrs)
+	return h
+}
+
+func (h journalHandler) WithGroup(name string) slog.Handler {
+	h.Handler = h.Handler.WithGroup(name)
+	return h
+}
+
+func journalPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+const manifestKindArchiveMove string = "archive move"
+
+// getArchiveRoot returns the folder sweeps archive into.
+func getArchiveRoot(pref fyne.Preferences) string {
+	return path.Join(pref.String("HomeDir"), pref.String("AppFolder"))
+}
+
+// setArchiveRoot points the archive at root without moving anything.
+func setArchiveRoot(pref fyne.Preferences, root string) {
+	pref.SetString("HomeDir", path.Dir(root))
+	pref.SetString("AppFolder", path.Base(root))
+}
+
+// within reports whether p is dir or somewhere inside it.
+func within(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// movePrefix rewrites p when it lies inside from to the same place inside to.
+func movePrefix(p, from, to string) string {
+	if !within(p, from) {
+		return p
+	}
+	return to + strings.TrimPrefix(p, from)
+}
+
+// checkWritable makes sure files can be created in dir.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, partialPrefix+"check-")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkSourceFolder makes sure a profile can sweep source into archiveRoot.
+// Sweeping the folder that holds the archive would move the archive into
+// itself. Whether items can be removed from source is left to the settings
+// window, so sweeps never write to it just to check.
+func checkSourceFolder(source, archiveRoot string) error {
+	if !path.IsAbs(source) {
+		return fmt.Errorf("sweep location %s is not an absolute path", source)
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("sweep location %s is not a folder", source)
+	}
+	source, archiveRoot = path.Clean(source), path.Clean(archiveRoot)
+	if within(archiveRoot, source) {
+		return fmt.Errorf("the archive %s is inside the sweep location %s", archiveRoot, source)
+	}
+	if within(source, archiveRoot) {
+		return fmt.Errorf("sweep location %s is inside the archive %s", source, archiveRoot)
+	}
+	return nil
+}
+
+// checkArchiveFolder makes sure root can hold the archive of the profiles. A
+// root that does not exist yet is created by the first sweep, so its nearest
+// existing parent must be writable instead.
+func checkArchiveFolder(root string, profiles []sweepProfile) error {
+	if !path.IsAbs(root) {
+		return fmt.Errorf("archive location %s is not an absolute path", root)
+	}
+	root = path.Clean(root)
+	for _, p := range profiles {
+		if p.SourcePath == "" {
+			continue
+		}
+		source := path.Clean(p.SourcePath)
+		if within(root, source) {
+			return fmt.Errorf("the archive would be inside the sweep location %s of profile %s", source, p.Name)
+		}
+		if within(source, root) {
+			return fmt.Errorf("the sweep location %s of profile %s would be inside the archive", source, p.Name)
+		}
+	}
+
+	dir := root
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a folder", dir)
+			}
+			return checkWritable(dir)
+		}
+		if !errors.Is(err, fs.ErrNotExist) || dir == "/" {
+			return err
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// moveArchive moves everything archived so far into root and points the
+// archive there. The catalog, the hash index and the sweep history follow the
+// items so find, restore and undo keep working.
+func moveArchive(pref fyne.Preferences, appName, root string) (int, error) {
+	unlock, err := lockArchive(appName)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	root = path.Clean(root)
+	old := getArchiveRoot(pref)
+	if root == old {
+		return 0, nil
+	}
+	if err := checkArchiveFolder(root, loadProfiles(pref)); err != nil {
+		return 0, err
+	}
+	if within(root, old) || within(old, root) {
+		return 0, fmt.Errorf("%s and %s may not be inside each other", old, root)
+	}
+
+	now := time.Now()
+	m := sweepManifest{
+		ID:         now.UTC().Format(manifestIDStamp),
+		Kind:       manifestKindArchiveMove,
+		SweptAt:    now,
+		SourcePath: old,
+		TargetPath: root,
+		Moves:      []movedItem{},
+	}
+	moves, moveErr := moveArchiveItems(old, root)
+	m.Moves = append(m.Moves, moves...)
+	if len(moves) > 0 {
+		relocateArchive(pref, appName, moves)
+	}
+	// Point at the new place once anything has moved there, even if some of
+	// the archive was left behind
+	if moveErr == nil || len(moves) > 0 {
+		setArchiveRoot(pref, root)
+	}
+	if moveErr != nil {
+		m.Error = moveErr.Error()
+	}
+	finishedAt := time.Now()
+	m.FinishedAt = &finishedAt
+	if len(moves) > 0 || moveErr != nil {
+		if err := saveManifest(getManifestDir(appName), m); err != nil {
+			slog.Warn("Unable to record archive move in sweep history.", slog.Any("error", err))
+		}
+	}
+	slog.Info("Moved archive.", slog.String("from", old), slog.String("to", root), slog.Int("itemCount", len(moves)))
+	return len(moves), moveErr
+}
+
+// moveArchiveItems moves the folder old to root, or each of its entries when
+// root already exists, numbering any names that are taken there.
+func moveArchiveItems(old, root string) ([]movedItem, error) {
+	if _, err := os.Stat(old); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err := os.MkdirAll(path.Dir(root), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if !exists(root) {
+		if err := moveFile(old, root); err != nil {
+			return nil, err
+		}
+		return []movedItem{{Original: old, Archived: root}}, nil
+	}
+
+	entries, err := os.ReadDir(old)
+	if err != nil {
+		return nil, err
+	}
+	moves := []movedItem{}
+	for _, e := range entries {
+		src := path.Join(old, e.Name())
+		dst := freeName(path.Join(root, e.Name()), exists)
+		if err := moveFile(src, dst); err != nil {
+			return moves, err
+		}
+		moves = append(moves, movedItem{Original: src, Archived: dst})
+	}
+	if err := os.Remove(old); err != nil {
+		slog.Warn("Unable to remove old archive folder.", slog.Any("error", err), slog.String("folder", old))
+	}
+	return moves, nil
+}
+
+// relocateArchive updates everything that remembers where archived items are.
+func relocateArchive(pref fyne.Preferences, appName string, moves []movedItem) {
+	if err := relocateBundleIndexes(moves); err != nil {
+		slog.Warn("Unable to update bundle indexes.", slog.Any("error", err))
+	}
+	updateCatalog(pref, appName, func(c *sweepCatalog) {
+		for _, mv := range moves {
+			c.relocate(mv.Original, mv.Archived)
+		}
+	})
+	if err := relocateHashIndex(path.Join(getDataDir(appName), hashIndexFile), moves); err != nil {
+		slog.Warn("Unable to update hash index.", slog.Any("error", err))
+	}
+	if err := relocateManifests(getManifestDir(appName), moves); err != nil {
+		slog.Warn("Unable to update sweep history.", slog.Any("error", err))
+	}
+}
+
+// relocateBundleIndexes rewrites the bundle and folder paths of the bundle
+// indexes that were moved, so items can still be restored from the bundles.
+func relocateBundleIndexes(moves []movedItem) error {
+	for _, mv := range moves {
+		err := filepath.WalkDir(mv.Archived, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() || !strings.HasSuffix(p, bundleIndexExt) {
+				return err
+			}
+			idx, err := loadBundleIndex(strings.TrimSuffix(p, bundleIndexExt))
+			if err != nil {
+				return err
+			}
+			for _, mv := range moves {
+				idx.Bundle = movePrefix(idx.Bundle, mv.Original, mv.Archived)
+				idx.Folder = movePrefix(idx.Folder, mv.Original, mv.Archived)
+			}
+			return saveBundleIndex(idx)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relocateHashIndex rewrites the paths of the hash index in place, leaving the
+// hashes alone so the archive is not read again.
+func relocateHashIndex(file string, moves []movedItem) error {
+	return rewriteHashIndex(file, func(p string) (string, bool) {
+		for _, mv := range moves {
+			p = movePrefix(p, mv.Original, mv.Archived)
+		}
+		return p, true
+	})
+}
+
+// forgetHashes drops the files inside folders from the hash index.
+func forgetHashes(file string, folders []string) error {
+	return rewriteHashIndex(file, func(p string) (string, bool) {
+		for _, folder := range folders {
+			if within(p, folder) {
+				return "", false
+			}
+		}
+		return p, true
+	})
+}
+
+// rewriteHashIndex passes every path of the hash index through rewrite,
+// dropping those it does not keep.
+func rewriteHashIndex(file string, rewrite func(p string) (string, bool)) error {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	idx := &hashIndex{file: file}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return err
+	}
+	files := map[string]hashedFile{}
+	for p, f := range idx.Files {
+		if p, ok := rewrite(p); ok {
+			files[p] = f
+		}
+	}
+	idx.Files = files
+	return idx.save()
+}
+
+// relocateManifests rewrites the archived paths recorded by every run.
+func relocateManifests(dir string, moves []movedItem) error {
+	manifests, err := listManifests(dir)
+	if err != nil {
+		return err
+	}
+	relocate := func(p string) string {
+		for _, mv := range moves {
+			p = movePrefix(p, mv.Original, mv.Archived)
+		}
+		return p
+	}
+	for _, m := range manifests {
+		m.TargetPath = relocate(m.TargetPath)
+		for i := range m.Moves {
+			m.Moves[i].Archived = relocate(m.Moves[i].Archived)
+			if m.Kind == manifestKindRetention {
+				m.Moves[i].Original = relocate(m.Moves[i].Original)
+			}
+		}
+		for i := range m.Deleted {
+			m.Deleted[i] = relocate(m.Deleted[i])
+		}
+		for i := range m.Restored {
+			m.Restored[i].Archived = relocate(m.Restored[i].Archived)
+		}
+		if err := saveManifest(dir, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on f, waiting for any other process that
+// holds it. Closing f releases the lock.
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		slog.Info("Waiting for another process to finish with the archive.", slog.String("file", f.Name()))
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestLockFileWaits(t *testing.T) {
+	file := path.Join(t.TempDir(), archiveLockFile)
+	held, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lockFile(held); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second open file stands in for another process
+	locked := make(chan error, 1)
+	go func() {
+		f, err := os.OpenFile(file, os.O_RDWR, 0600)
+		if err != nil {
+			locked <- err
+			return
+		}
+		defer f.Close()
+		locked <- lockFile(f)
+	}()
+
+	select {
+	case err := <-locked:
+		t.Fatalf("second lock taken while the first is held: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	held.Close()
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second lock not taken after the first was released")
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile takes an exclusive lock on f, waiting for any other process that
+// holds it. Closing f releases the lock.
+func lockFile(f *os.File) error {
+	h := windows.Handle(f.Fd())
+	err := windows.LockFileEx(h, windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, new(windows.Overlapped))
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		slog.Info("Waiting for another process to finish with the archive.", slog.String("file", f.Name()))
+		err = windows.LockFileEx(h, windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, new(windows.Overlapped))
+	}
+	return err
+}
@@ -1,87 +1,201 @@
 package main
 
 import (
-	"errors"
 	"fmt"
-	"io/fs"
 	"log/slog"
+	"net/url"
 	"os"
 	"path"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/widget"
 	"github.com/adrg/xdg"
-	"github.com/jannson/go-autostart"
 )
 
 const (
 	appNamespace      string = "com.github.mikeharris.DeskClean"
 	sweptMenuLabel    string = "Swept at %s"
+	lastSweepStamp    string = "Jan 2 3:04PM"
 	sweepMenuLabel    string = "Sweep now"
+	previewMenuLabel  string = "Preview sweep"
+	undoMenuLabel     string = "Undo last sweep"
+	findMenuLabel     string = "Find swept items"
+	historyMenuLabel  string = "Sweep history"
+	cleanupMenuLabel  string = "Clean up archive"
 	settingsMenuLabel string = "Settings"
 	logFileExt        string = ".log"
 	appNameDefault    string = "DeskClean"
 )
 
 var (
-	allowedRunIntervals = []string{"every minute", "every 5 minutes", "every 15 minutes", "every 30 minutes", "every hour", "every 4 hours", "every 24 hours", "on demand"}
-	allowedDateFormats  = []string{"2006-01-02", "2006-Jan-02", "01-02-2006", "Jan-02-2006", "2006-01", "2006-Jan", "01-2006", "Jan-2006"}
-	version             string
-	build               string
-	buildDate           string
-	commit              string
+	allowedDateFormats = []string{"2006-01-02", "2006-Jan-02", "01-02-2006", "Jan-02-2006", "2006-01", "2006-Jan", "01-2006", "Jan-2006"}
+	version            string
+	build              string
+	buildDate          string
+	commit             string
 )
 
 func main() {
+	// Any argument that isn't a flag is a command line subcommand, and the
+	// flags of older versions run the commands that replaced them
+	if len(os.Args) > 1 {
+		args := os.Args[1:]
+		if command, ok := cliFlagAliases[args[0]]; ok {
+			args[0] = command
+		}
+		if !strings.HasPrefix(args[0], "-") {
+			os.Exit(runCommand(args))
+		}
+	}
+
 	doneChan := make(chan bool)
-	resetChan := make(chan int)
+	resetChan := make(chan bool)
 
 	a := app.NewWithID(appNamespace)
 	prefs := a.Preferences()
 	appName := prefs.StringWithFallback("AppName", appNameDefault)
 
-	logger := slog.New(slog.NewJSONHandler(getLogFile(runtime.GOOS, appName, appName+logFileExt), nil))
-	slog.SetDefault(logger)
+	slog.SetDefault(newLogger(appName))
 	slog.SetLogLoggerLevel(slog.LevelDebug)
+	prefs = layerBaseline(prefs, getBaselineFile(runtime.GOOS))
 
 	var menu *fyne.Menu
 	lastSweepMenu := fyne.NewMenuItem(fmt.Sprintf(sweptMenuLabel, prefs.String("LastSweep")), func() {})
 
-	if prefs.BoolWithFallback("FirstRun", true) {
-		initAppDefaults(a.Preferences())
-	}
+	migratePreferences(prefs)
 
 	exe, err := getAppExecutable(runtime.GOOS, appName)
 	if err != nil {
 		panic("Unable to determine app executable.")
 	}
-	startApp := &autostart.App{
-		Name:        appNamespace,
-		DisplayName: appName,
-		Exec:        []string{exe},
-	}
+	startApp := newLoginLauncher(exe, appName)
 	autoLaunch := prefs.Bool("AutoLaunchApp")
 
 	w := a.NewWindow(appName + " Settings")
+	rw := a.NewWindow(appName)
+	rw.Resize(fyne.NewSize(640, 400))
+	rw.SetCloseIntercept(rw.Hide)
+	fw := a.NewWindow(appName + " Find")
+	fw.Resize(fyne.NewSize(720, 480))
+	fw.SetCloseIntercept(fw.Hide)
+	hw := a.NewWindow(appName + " Sweep History")
+	hw.Resize(fyne.NewSize(720, 520))
+	hw.SetCloseIntercept(hw.Hide)
+	showHistory := func() {
+		manifests, err := listManifests(getManifestDir(appName))
+		if err != nil {
+			slog.Warn("Unable to read sweep history.", slog.Any("error", err))
+		}
+		hw.SetContent(makeHistoryUI(manifests))
+		hw.Show()
+	}
+	lastSweepMenu.Action = showHistory
+
+	sweepEntries := func(p sweepProfile, only []string, trigger sweepTrigger) {
+		plan, err := runSweep(prefs, appName, p, only, trigger)
+		if err != nil {
+			slog.Error("Failed to sweep source files.", slog.Any("error", err), slog.String("profile", p.Name))
+		}
+		notifySweep(prefs, p, plan, err, a.SendNotification)
+		go enforceRetention(prefs, appName)
+		prefs.SetString("LastSweep", time.Now().Format(lastSweepStamp))
+		lastSweepMenu.Label = fmt.Sprintf(sweptMenuLabel, prefs.String("LastSweep"))
+		if menu != nil {
+			menu.Refresh()
+		}
+	}
+	sweepProfileNow := func(p sweepProfile) {
+		sweepEntries(p, nil, triggerManual)
+	}
+	previewProfile := func(p sweepProfile) {
+		plan, err := previewSweep(prefs, appName, p)
+		if err != nil {
+			slog.Warn("Failed to preview sweep.", slog.Any("error", err), slog.String("profile", p.Name))
+		}
+		rw.SetTitle(fmt.Sprintf("%s Sweep Preview: %s", appName, p.Name))
+		rw.SetContent(makePreviewUI(plan))
+		rw.Show()
+	}
+
+	sweepMenu := fyne.NewMenuItem(sweepMenuLabel, nil)
+	previewMenu := fyne.NewMenuItem(previewMenuLabel, nil)
+	refreshProfileMenus := func() {
+		profiles := loadProfiles(prefs)
+		sweepMenu.ChildMenu = makeProfileMenu(profiles, sweepProfileNow)
+		previewMenu.ChildMenu = makeProfileMenu(profiles, previewProfile)
+		if menu != nil {
+			menu.Refresh()
+		}
+	}
+	refreshProfileMenus()
 
 	if desk, ok := a.(desktop.App); ok {
 		menu = fyne.NewMenu(appName,
-			fyne.NewMenuItem(sweepMenuLabel, func() {
-				err := sweepFiles(os.DirFS(prefs.String("SourcePath")), prefs.String("SourcePath"), getTargetPath(prefs))
+			sweepMenu,
+			previewMenu,
+			fyne.NewMenuItem(undoMenuLabel, func() {
+				report, err := undoSweep(prefs, appName)
 				if err != nil {
-					slog.Warn("Failed to move source files. ", slog.Any("error", err))
+					slog.Warn("Failed to undo last sweep.", slog.Any("error", err))
 				}
-				prefs.SetString("LastSweep", time.Now().Format(time.Kitchen))
-				lastSweepMenu.Label = fmt.Sprintf(sweptMenuLabel, prefs.String("LastSweep"))
-				menu.Refresh()
+				rw.SetTitle(appName + " Undo")
+				rw.SetContent(makeUndoUI(report, err))
+				rw.Show()
+			}),
+			fyne.NewMenuItem(historyMenuLabel, showHistory),
+			fyne.NewMenuItem(findMenuLabel, func() {
+				c, err := openCatalog(prefs, appName)
+				if err != nil {
+					slog.Warn("Unable to open catalog.", slog.Any("error", err))
+					return
+				}
+				open := func(item catalogItem) {
+					if err := a.OpenURL(&url.URL{Scheme: "file", Path: path.Dir(item.Archived)}); err != nil {
+						slog.Warn("Unable to open archive folder.", slog.Any("error", err), slog.String("file", item.Archived))
+					}
+				}
+				restore := func(item catalogItem) (string, error) {
+					policy := collisionPolicy(prefs.StringWithFallback("CollisionPolicy", string(collisionNumber)))
+					_, dst, err := restoreSwept(prefs, appName, item.ID, policy)
+					if err != nil {
+						slog.Warn("Failed to restore swept item.", slog.Any("error", err), slog.String("file", item.location()))
+						return dst, err
+					}
+					// Pick up the restored state for the next search
+					if fresh, err := openCatalog(prefs, appName); err == nil {
+						c = fresh
+					}
+					return dst, nil
+				}
+				fw.SetContent(makeFindUI(func(query string) []catalogItem { return c.search(query) }, open, restore))
+				fw.Show()
+			}),
+			fyne.NewMenuItem(cleanupMenuLabel, func() {
+				plan, err := previewRetention(prefs, time.Now())
+				if err != nil {
+					slog.Warn("Failed to preview archive clean up.", slog.Any("error", err))
+				}
+				rw.SetTitle(appName + " Archive Clean Up")
+				rw.SetContent(makeRetentionUI(plan, func() retentionPlan {
+					done, err := runRetention(prefs, appName, true)
+					if err != nil {
+						slog.Warn("Failed to clean up archive.", slog.Any("error", err))
+					}
+					return done
+				}))
+				rw.Show()
 			}),
 			fyne.NewMenuItem(settingsMenuLabel, func() {
 				w.Show()
@@ -93,9 +207,12 @@ func main() {
 		desk.SetSystemTrayMenu(menu)
 	}
 
-	w.SetContent(makeSettingsUI(prefs))
+	w.SetContent(makeSettingsUI(w, prefs, appName))
+	w.Resize(fyne.NewSize(640, 600))
 	w.SetCloseIntercept(func() {
-		prefs.SetInt("RunIntervalMinutes", runIntervalToInt(prefs.String("RunInterval")))
+		// Pick up added, removed or rescheduled profiles
+		refreshProfileMenus()
+		resetChan <- true
 		// Determine if AutoLaunchApp is dirty
 		if autoLaunch != prefs.Bool("AutoLaunchApp") {
 			// autoLaunch and the pref aren't the same so inverse it to make it the same
@@ -105,7 +222,7 @@ func main() {
 					slog.Warn("Unable to unset auto launch.", slog.Any("error", err))
 				}
 			} else if !startApp.IsEnabled() && autoLaunch {
-				slog.Info("Creating LaunchAgent plist.")
+				slog.Info("Enabling launch at login.")
 				if err := startApp.Enable(); err != nil {
 					slog.Warn("Unable to set auto launch.", slog.Any("error", err))
 				}
@@ -114,47 +231,17 @@ func main() {
 		w.Hide()
 	})
 
-	// Invoke background ticker with reasonable tick rate
-	sweepTicker := time.NewTicker(60 * time.Minute)
-
-	// Reset ticker if preference is set to anything other than on demand
-	if prefs.Int("RunIntervalMinutes") > -1 {
-		sweepTicker.Reset(time.Duration(prefs.Int("RunIntervalMinutes")) * time.Minute)
-	}
-
-	// Create a data binding with the pref RunIntervalMinutes
-	runInterval := binding.BindPreferenceInt("RunIntervalMinutes", prefs)
-
-	// Add change listener to the RunIntervalMinutes property/preference
-	callback := binding.NewDataListener(func() {
-		ri, _ := runInterval.Get()
-		resetChan <- ri
-	})
-	runInterval.AddListener(callback)
-
-	// Start background sweeper thread
+	// Start background sweeper thread, one ticker per profile
 	go func() {
+		stop := scheduleProfiles(loadProfiles(prefs), sweepEntries)
 		for {
 			select {
 			case <-doneChan:
+				close(stop)
 				return
-			case i := <-resetChan:
-				if i > -1 {
-					sweepTicker.Reset(time.Duration(i) * time.Minute)
-					slog.Info("Set sweep timer event.", slog.Int("RunIntervalMinutes", prefs.Int("RunIntervalMinutes")))
-				} else {
-					slog.Info("Sweeper set to run on demand.")
-				}
-			case <-sweepTicker.C:
-				if prefs.Int("RunIntervalMinutes") > 0 {
-					err := sweepFiles(os.DirFS(prefs.String("SourcePath")), prefs.String("SourcePath"), getTargetPath(prefs))
-					if err != nil {
-						slog.Error("Failed to sweep source files.", slog.Any("error", err))
-					}
-					prefs.SetString("LastSweep", time.Now().Format(time.Kitchen))
-					lastSweepMenu.Label = fmt.Sprintf(sweptMenuLabel, prefs.String("LastSweep"))
-					menu.Refresh()
-				}
+			case <-resetChan:
+				close(stop)
+				stop = scheduleProfiles(loadProfiles(prefs), sweepEntries)
 			}
 		}
 	}()
@@ -169,9 +256,8 @@ func getLogFile(osName, appName, logFilename string) *os.File {
 	switch osName {
 	case "darwin":
 		log = path.Join(xdg.Home, "Library", "Logs", appName, logFilename)
-	case "default":
+	default:
 		log = path.Join(xdg.DataHome, appName, "logs", logFilename)
-
 	}
 
 	if _, err := os.Stat(log); os.IsNotExist(err) {
@@ -187,6 +273,26 @@ func getLogFile(osName, appName, logFilename string) *os.File {
 	return logFile
 }
 
+// newLogger logs to the app log file, or to stderr for the journal when the
+// app was started by systemd.
+func newLogger(appName string) *slog.Logger {
+	if underSystemd() {
+		return slog.New(newJournalHandler(os.Stderr, slog.LevelInfo))
+	}
+	return slog.New(slog.NewJSONHandler(getLogFile(runtime.GOOS, appName, appName+logFileExt), nil))
+}
+
+// loginLauncher starts the tray app when the user logs in.
+type loginLauncher interface {
+	IsEnabled() bool
+	Enable() error
+	Disable() error
+}
+
+func getDataDir(appName string) string {
+	return path.Join(xdg.DataHome, appName)
+}
+
 func getAppExecutable(osName, appName string) (string, error) {
 	var e string
 	var err error
@@ -194,132 +300,728 @@ func getAppExecutable(osName, appName string) (string, error) {
 	switch osName {
 	case "darwin":
 		e = path.Join(xdg.ApplicationDirs[0], appName) + ".app"
-	case "default":
+	default:
 		e, err = os.Executable()
 		if err != nil {
 			return "", err
 		}
-
 	}
 
 	return e, nil
 }
 
-func makeSettingsUI(pref fyne.Preferences) fyne.CanvasObject {
-	al := widget.NewLabel(pref.String("HomeDir"))
-	ri := widget.NewSelect(allowedRunIntervals, func(value string) { pref.SetString("RunInterval", value) })
-	ri.SetSelected(pref.String("RunInterval"))
+func makeSettingsUI(w fyne.Window, pref fyne.Preferences, appName string) fyne.CanvasObject {
+	al := widget.NewEntry()
+	al.SetText(getArchiveRoot(pref))
+	// Typed locations are applied with enter, the entry shows where the archive
+	// really is once that is settled
+	al.OnSubmitted = func(s string) {
+		changeArchiveRoot(w, pref, appName, s, func() { al.SetText(getArchiveRoot(pref)) })
+	}
+	ab := widget.NewButton("Browse…", func() {
+		showFolderPicker(w, getArchiveRoot(pref), func(p string) {
+			al.SetText(p)
+			al.OnSubmitted(p)
+		})
+	})
+
+	cp := widget.NewSelect(allowedCollisionPolicies, func(value string) { pref.SetString("CollisionPolicy", value) })
+	cp.SetSelected(pref.StringWithFallback("CollisionPolicy", string(collisionNumber)))
 
-	df := widget.NewSelect(allowedDateFormats, func(value string) { pref.SetString("TargetFolderDateScheme", value) })
-	df.SetSelected(pref.String("TargetFolderDateScheme"))
+	np := widget.NewSelect(allowedNotifyPolicies, func(value string) { pref.SetString("NotifyPolicy", value) })
+	np.SetSelected(pref.StringWithFallback("NotifyPolicy", string(notifyErrors)))
+	quietStart := makeClockEntry(pref, "QuietHoursStart", "22:00")
+	quietEnd := makeClockEntry(pref, "QuietHoursEnd", "07:00")
 
-	af := widget.NewEntryWithData(binding.BindPreferenceString("AppFolder", pref))
-	af.OnChanged = func(s string) {
-		al.SetText(path.Join(pref.String("HomeDir"), s))
-	}
+	dp := widget.NewSelect(allowedDuplicatePolicies, func(value string) { pref.SetString("DuplicatePolicy", value) })
+	dp.SetSelected(pref.StringWithFallback("DuplicatePolicy", string(duplicateOff)))
+	dh := widget.NewSelect(allowedHashAlgorithms, func(value string) { pref.SetString("DuplicateHash", value) })
+	dh.SetSelected(pref.StringWithFallback("DuplicateHash", string(hashSHA256)))
+
+	ib := widget.NewButton("Import…", func() {
+		dialog.ShowFileOpen(func(r fyne.URIReadCloser, err error) {
+			if err != nil || r == nil {
+				return
+			}
+			r.Close()
+			if err := importConfigFile(pref, r.URI().Path()); err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			// Rebuild the window so every field shows the imported value
+			w.SetContent(makeSettingsUI(w, pref, appName))
+		}, w)
+	})
+	eb := widget.NewButton("Export…", func() {
+		d := dialog.NewFileSave(func(wc fyne.URIWriteCloser, err error) {
+			if err != nil || wc == nil {
+				return
+			}
+			wc.Close()
+			if err := exportConfigFile(pref, wc.URI().Path()); err != nil {
+				dialog.ShowError(err, w)
+			}
+		}, w)
+		d.SetFileName(strings.ToLower(appName) + ".yaml")
+		d.Show()
+	})
 
 	wc := container.NewPadded(container.NewPadded(container.New(layout.NewFormLayout(),
-		widget.NewLabel("App Folder:"), af,
-		widget.NewLabel("Sweep Folder Name:"), widget.NewEntryWithData(binding.BindPreferenceString("TargetFolderLabel", pref)),
-		widget.NewLabel("Sweep Folder Seperator:"), widget.NewEntryWithData(binding.BindPreferenceString("TargetFolderSeperator", pref)),
-		widget.NewLabel("Sweep Folder Date Format:"), df,
-		widget.NewLabel("Run Inteval:"), ri,
+		widget.NewLabel("Archive Location:"), container.NewBorder(nil, nil, nil, ab, al),
+		widget.NewLabel("Sweep Folder Separator:"), widget.NewEntryWithData(binding.BindPreferenceString("TargetFolderSeparator", pref)),
+		widget.NewLabel("When Name Exists:"), cp,
+		widget.NewLabel("Duplicates:"), container.NewHBox(dp, dh),
+		widget.NewLabel("Notify:"), container.NewHBox(np, widget.NewLabel("quiet from"), quietStart, widget.NewLabel("to"), quietEnd),
 		widget.NewLabel("Launch app at login:"), widget.NewCheckWithData("Enabled", binding.BindPreferenceBool("AutoLaunchApp", pref)),
-		widget.NewLabel("Sweep Location:"), widget.NewLabelWithData(binding.BindPreferenceString("SourcePath", pref)),
-		widget.NewLabel("Archive Location:"), al)))
-	return wc
-}
+		widget.NewLabel("Configuration:"), container.NewHBox(ib, eb))))
 
-func initAppDefaults(pref fyne.Preferences) {
-	pref.SetString("AppName", appNameDefault)
-	pref.SetString("AppFolder", appNameDefault)
-	pref.SetString("HomeDir", xdg.Home)
-	pref.SetString("TargetFolderLabel", "Archive")
-	pref.SetString("TargetFolderSeperator", "-")
-	pref.SetString("TargetFolderDateScheme", "2006-01-02")
-	pref.SetString("RunInterval", "every hour")
-	pref.SetInt("RunIntervalMinutes", 60)
-	pref.SetString("SourcePath", xdg.UserDirs.Desktop)
-	pref.SetBool("FirstRun", false)
-	pref.SetBool("AutoLaunchApp", false)
-	slog.Info("Configuration initialized to defaults.")
+	rules := makeStringListUI(pref, "Rules", "*.png|*.jpg -> Screenshots/", func(text string) error {
+		_, err := parseRule(text)
+		return err
+	})
+	ignore := makeStringListUI(pref, "IgnorePatterns", "Keep, *.desktop or /^~.*/", func(text string) error {
+		_, err := parseIgnorePattern(text)
+		return err
+	})
+	return container.NewBorder(wc, nil, nil, nil, container.NewAppTabs(
+		container.NewTabItem("Profiles", container.NewPadded(makeProfilesUI(w, pref))),
+		container.NewTabItem("Rules", container.NewPadded(widget.NewCard("", "Checked in order against each item, the first match wins.", rules))),
+		container.NewTabItem("Exclusions", container.NewPadded(widget.NewCard("", "Names, globs or /regular expressions/ that are never swept. A "+ignoreFileName+" file in the sweep location is honored too.", ignore))),
+		container.NewTabItem("Retention", container.NewPadded(makeRetentionSettingsUI(pref)))))
 }
 
-func getTargetPath(pref fyne.Preferences) string {
-	now := time.Now()
-	dateStr := now.Format(pref.String("TargetFolderDateScheme"))
-	folderDateLabel := fmt.Sprintf("%s%s%s", dateStr, pref.String("TargetFolderSeperator"), pref.String("TargetFolderLabel"))
-	return path.Join(pref.String("HomeDir"), pref.String("AppFolder"), folderDateLabel)
+// showFolderPicker lets the user pick a folder, starting from current when it
+// exists, and calls picked with its path.
+func showFolderPicker(w fyne.Window, current string, picked func(string)) {
+	d := dialog.NewFolderOpen(func(uri fyne.ListableURI, err error) {
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		if uri != nil {
+			picked(uri.Path())
+		}
+	}, w)
+	if l, err := storage.ListerForURI(storage.NewFileURI(current)); err == nil {
+		d.SetLocation(l)
+	}
+	d.Show()
 }
 
-func sweepFiles(fsys fs.FS, sourcePath, targetPath string) error {
-	moveCount := 0
-	skippedCount := 0
-	errorCount := 0
-	targeExists := false
+// changeArchiveRoot points the archive at root, offering to move what is
+// already archived along with it. done is called once that is settled.
+func changeArchiveRoot(w fyne.Window, pref fyne.Preferences, appName, root string, done func()) {
+	root = path.Clean(strings.TrimSpace(root))
+	old := getArchiveRoot(pref)
+	if root == old {
+		done()
+		return
+	}
+	if err := checkArchiveFolder(root, loadProfiles(pref)); err != nil {
+		dialog.ShowError(err, w)
+		done()
+		return
+	}
+	if entries, err := os.ReadDir(old); err != nil || len(entries) == 0 {
+		setArchiveRoot(pref, root)
+		slog.Info("Changed archive location.", slog.String("folder", root))
+		done()
+		return
+	}
 
-	fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
+	msg := widget.NewLabel(fmt.Sprintf("Move everything already archived in %s to %s?\n\nLeaving it means find, restore and retention only see what is swept from now on.", old, root))
+	msg.Wrapping = fyne.TextWrapWord
+	d := dialog.NewCustomConfirm("Move Archive", "Move", "Leave It", msg, func(move bool) {
+		if !move {
+			setArchiveRoot(pref, root)
+			slog.Info("Changed archive location.", slog.String("folder", root))
+			done()
+			return
 		}
-		if d.Type().IsRegular() || d.Type().IsDir() {
-			if strings.HasPrefix(d.Name(), ".") {
-				skippedCount++
+		go func() {
+			n, err := moveArchive(pref, appName, root)
+			if err != nil {
+				dialog.ShowError(err, w)
 			} else {
-				if !targeExists {
-					// Determine if parent path needs created and only create if there is a file/folder to write
-					err = createTargetDirectory(targetPath)
-					if err != nil {
-						slog.Error("Unable to create target directory. ", slog.Any("error", err))
-						// If we cannot create the containing folder then fail fast
-						return err
-					}
-					targeExists = true
-				}
+				dialog.ShowInformation("Archive Moved", fmt.Sprintf("Moved %d items to %s.", n, root), w)
+			}
+			done()
+		}()
+	}, w)
+	d.Resize(fyne.NewSize(480, 0))
+	d.Show()
+}
 
-				err = os.Rename(path.Join(sourcePath, p), path.Join(targetPath, p))
-				if err != nil {
-					errorCount++
-					slog.Warn("Failed to move file.", slog.Any("error", err), slog.String("file", p))
-				} else {
-					moveCount++
-				}
+// makeClockEntry edits a time of day such as "22:00". Clearing it unsets the key.
+func makeClockEntry(pref fyne.Preferences, key, placeholder string) *widget.Entry {
+	e := widget.NewEntry()
+	e.SetPlaceHolder(placeholder)
+	e.SetText(pref.String(key))
+	e.Validator = func(s string) error {
+		if s == "" {
+			return nil
+		}
+		_, err := parseClock(s)
+		return err
+	}
+	e.OnChanged = func(s string) {
+		if e.Validator(s) == nil {
+			pref.SetString(key, s)
+		}
+	}
+	return e
+}
+
+// makeRetentionSettingsUI edits how long dated archive folders are kept.
+func makeRetentionSettingsUI(pref fyne.Preferences) fyne.CanvasObject {
+	dailyDays := widget.NewEntry()
+	dailyDays.SetText(strconv.Itoa(pref.Int("RetentionDailyDays")))
+	dailyDays.OnChanged = func(s string) {
+		if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+			pref.SetInt("RetentionDailyDays", n)
+		}
+	}
+	keepDays := widget.NewEntry()
+	keepDays.SetText(strconv.Itoa(pref.Int("RetentionKeepDays")))
+	keepDays.OnChanged = func(s string) {
+		if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+			pref.SetInt("RetentionKeepDays", n)
+		}
+	}
+	bundleDays := widget.NewEntry()
+	bundleDays.SetText(strconv.Itoa(pref.Int("BundleAfterDays")))
+	bundleDays.OnChanged = func(s string) {
+		if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+			pref.SetInt("BundleAfterDays", n)
+		}
+	}
+	bundleFormat := widget.NewSelect(allowedBundleFormats, func(value string) { pref.SetString("BundleFormat", value) })
+	bundleFormat.SetSelected(pref.StringWithFallback("BundleFormat", string(bundleZip)))
+	confirm := widget.NewCheck("Ask before deleting", func(b bool) { pref.SetBool("RetentionConfirmDeletes", b) })
+	confirm.SetChecked(pref.BoolWithFallback("RetentionConfirmDeletes", true))
+
+	return widget.NewCard("", "Checked after every sweep, 0 days turns a step off. Folders waiting to be deleted are listed under "+cleanupMenuLabel+" in the tray menu.",
+		container.New(layout.NewFormLayout(),
+			widget.NewLabel("Merge Daily Folders Into Months After (days):"), dailyDays,
+			widget.NewLabel("Compress Folders After (days):"), container.NewBorder(nil, nil, nil, bundleFormat, bundleDays),
+			widget.NewLabel("Delete Folders After (days):"), keepDays,
+			layout.NewSpacer(), confirm))
+}
+
+// makeProfilesUI lists the sweep profiles and edits the selected one. Every
+// change is saved straight away.
+func makeProfilesUI(w fyne.Window, pref fyne.Preferences) fyne.CanvasObject {
+	profiles := loadProfiles(pref)
+	selected := -1
+
+	list := widget.NewList(
+		func() int { return len(profiles) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) { o.(*widget.Label).SetText(profiles[i].Name) })
+
+	// edit applies a change to the selected profile and saves them all
+	edit := func(change func(p *sweepProfile)) {
+		if selected < 0 || selected >= len(profiles) {
+			return
+		}
+		change(&profiles[selected])
+		saveProfiles(pref, profiles)
+	}
+
+	name := widget.NewEntry()
+	name.Validator = func(s string) error {
+		// Nothing is selected while the form is filled
+		if selected < 0 {
+			return nil
+		}
+		return checkProfileName(profiles, selected, s)
+	}
+	name.OnChanged = func(s string) {
+		if name.Validator(s) == nil {
+			edit(func(p *sweepProfile) { p.Name = s })
+			list.Refresh()
+		}
+	}
+	source := widget.NewEntry()
+	source.Validator = func(s string) error {
+		if err := checkSourceFolder(s, getArchiveRoot(pref)); err != nil {
+			return err
+		}
+		return checkWritable(s)
+	}
+	source.OnChanged = func(s string) {
+		// Only keep locations that can be swept, the entry says what is wrong otherwise
+		if source.Validator(s) == nil {
+			edit(func(p *sweepProfile) { p.SourcePath = s })
+		}
+	}
+	sb := widget.NewButton("Browse…", func() { showFolderPicker(w, source.Text, source.SetText) })
+	example := widget.NewLabel("")
+	example.Wrapping = fyne.TextWrapWord
+	ft := widget.NewEntry()
+	ft.SetPlaceHolder(defaultFolderTemplate)
+	// preview shows where the selected profile puts an example file
+	preview := func() {
+		if selected < 0 || selected >= len(profiles) {
+			return
+		}
+		p := profiles[selected]
+		p.FolderTemplate = ft.Text
+		desc, err := describeFolderTemplate(pref, p, time.Now())
+		if err != nil {
+			example.SetText(err.Error())
+			return
+		}
+		example.SetText(desc)
+	}
+	ft.OnChanged = func(s string) {
+		// Only keep templates that parse, the preview says what is wrong otherwise
+		if s != "" {
+			if _, err := parseFolderTemplate(s); err != nil {
+				preview()
+				return
 			}
 		}
-		return nil
+		edit(func(p *sweepProfile) { p.FolderTemplate = s })
+		preview()
+	}
+	label := widget.NewEntry()
+	label.OnChanged = func(s string) {
+		edit(func(p *sweepProfile) { p.Label = s })
+		preview()
+	}
+	df := widget.NewSelect(allowedDateFormats, func(value string) {
+		edit(func(p *sweepProfile) { p.DateScheme = value })
+		preview()
+	})
+	db := widget.NewSelect(allowedDateBases, func(value string) {
+		edit(func(p *sweepProfile) { p.DateBasis = value })
+		preview()
 	})
-	slog.Info("Sweep completed.", slog.Int("sweptFileCount", moveCount), slog.Int("skippedFileCount", skippedCount), slog.Int("fileErrorCount", errorCount))
-	return nil
+	next := widget.NewLabel("")
+	next.Wrapping = fyne.TextWrapWord
+	ri := widget.NewSelectEntry(schedulePresets)
+	ri.SetPlaceHolder("cron spec, e.g. 0 18 * * 1-5")
+	ri.OnChanged = func(value string) {
+		// Only keep schedules that parse, the label says what is wrong otherwise
+		desc, err := describeSchedule(value, time.Now())
+		if err != nil {
+			next.SetText(err.Error())
+			return
+		}
+		next.SetText(desc)
+		edit(func(p *sweepProfile) { p.Schedule = value })
+	}
+	ma := widget.NewEntry()
+	ma.Validator = checkMinimumAge
+	ma.OnChanged = func(s string) {
+		if checkMinimumAge(s) == nil {
+			n, _ := strconv.Atoi(s)
+			edit(func(p *sweepProfile) { p.MinimumAge = n })
+		}
+	}
+	mu := widget.NewSelect(allowedAgeUnits, func(value string) { edit(func(p *sweepProfile) { p.MinimumAgeUnit = value }) })
+	mb := widget.NewSelect(allowedAgeBases, func(value string) { edit(func(p *sweepProfile) { p.MinimumAgeBasis = value }) })
+
+	form := container.New(layout.NewFormLayout(),
+		widget.NewLabel("Name:"), name,
+		widget.NewLabel("Sweep Location:"), container.NewBorder(nil, nil, nil, sb, source),
+		widget.NewLabel("Sweep Folder Name:"), label,
+		widget.NewLabel("Sweep Folder Date Format:"), df,
+		widget.NewLabel("Date Sweep Folders By:"), db,
+		widget.NewLabel("Sweep Folder Template:"), ft,
+		layout.NewSpacer(), example,
+		widget.NewLabel("Schedule:"), ri,
+		layout.NewSpacer(), next,
+		widget.NewLabel("Only Sweep Items Older Than:"), container.NewBorder(nil, nil, nil, container.NewHBox(mu, widget.NewLabel("by"), mb), ma))
+	form.Hide()
+
+	list.OnSelected = func(i widget.ListItemID) {
+		// Clear the selection while filling the form so nothing is written back
+		selected = -1
+		p := profiles[i]
+		name.SetText(p.Name)
+		source.SetText(p.SourcePath)
+		label.SetText(p.Label)
+		df.SetSelected(p.DateScheme)
+		db.SetSelected(string(p.dateBasis()))
+		ft.SetText(p.FolderTemplate)
+		ri.SetText(p.Schedule)
+		ma.SetText(strconv.Itoa(p.MinimumAge))
+		mu.SetSelected(p.MinimumAgeUnit)
+		mb.SetSelected(p.MinimumAgeBasis)
+		selected = i
+		preview()
+		form.Show()
+	}
+	list.OnUnselected = func(widget.ListItemID) {
+		selected = -1
+		form.Hide()
+	}
+
+	add := widget.NewButton("Add", func() {
+		p := defaultProfile()
+		p.Name = freeProfileName(profiles)
+		profiles = append(profiles, p)
+		saveProfiles(pref, profiles)
+		list.Refresh()
+		list.Select(len(profiles) - 1)
+	})
+	remove := widget.NewButton("Remove", func() {
+		// Always keep at least one profile to sweep
+		if selected < 0 || len(profiles) < 2 {
+			return
+		}
+		profiles = append(profiles[:selected], profiles[selected+1:]...)
+		saveProfiles(pref, profiles)
+		list.UnselectAll()
+		list.Refresh()
+	})
+
+	return container.NewHSplit(
+		container.NewBorder(nil, container.NewHBox(add, remove), nil, nil, list),
+		container.NewVScroll(form))
 }
 
-func createTargetDirectory(targetPath string) error {
-	if _, err := os.Stat(targetPath); errors.Is(err, os.ErrNotExist) {
-		err := os.MkdirAll(targetPath, os.ModePerm)
+// makeStringListUI edits the string list preference stored under key. New items
+// are checked with validate before they are added.
+func makeStringListUI(pref fyne.Preferences, key, placeholder string, validate func(string) error) fyne.CanvasObject {
+	items := append([]string{}, pref.StringList(key)...)
+	selected := -1
+	status := widget.NewLabel("")
+
+	list := widget.NewList(
+		func() int { return len(items) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) { o.(*widget.Label).SetText(items[i]) })
+	list.OnSelected = func(i widget.ListItemID) { selected = i }
+	list.OnUnselected = func(widget.ListItemID) { selected = -1 }
+
+	save := func() {
+		pref.SetStringList(key, append([]string{}, items...))
+		list.UnselectAll()
+		list.Refresh()
+	}
+
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder(placeholder)
+	add := widget.NewButton("Add", func() {
+		text := strings.TrimSpace(entry.Text)
+		if text == "" {
+			return
+		}
+		if err := validate(text); err != nil {
+			status.SetText(err.Error())
+			return
+		}
+		items = append(items, text)
+		entry.SetText("")
+		status.SetText("")
+		save()
+	})
+	remove := widget.NewButton("Remove", func() {
+		if selected < 0 {
+			return
+		}
+		items = append(items[:selected], items[selected+1:]...)
+		save()
+	})
+	up := widget.NewButton("Move Up", func() {
+		if selected < 1 {
+			return
+		}
+		items[selected-1], items[selected] = items[selected], items[selected-1]
+		save()
+	})
+
+	controls := container.NewBorder(nil, nil, nil, container.NewHBox(add, remove, up), entry)
+	return container.NewBorder(nil, container.NewVBox(controls, status), nil, nil, list)
+}
+
+func makePreviewUI(plan sweepPlan) fyne.CanvasObject {
+	summary := widget.NewLabel(fmt.Sprintf("%d to move, %d skipped", plan.count(actionMove), plan.count(actionSkip)))
+	list := widget.NewList(
+		func() int { return len(plan) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) { o.(*widget.Label).SetText(plan[i].String()) })
+	return container.NewBorder(summary, nil, nil, nil, list)
+}
+
+// makeHistoryUI lists every recorded run, newest first, with everything known
+// about the picked one, failures included, below.
+func makeHistoryUI(manifests []sweepManifest) fyne.CanvasObject {
+	details := widget.NewLabel("Pick a run to see its details.")
+	details.TextStyle = fyne.TextStyle{Monospace: true}
+	list := widget.NewList(
+		func() int { return len(manifests) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) { o.(*widget.Label).SetText(manifests[i].summary()) })
+	list.OnSelected = func(i widget.ListItemID) {
+		var b strings.Builder
+		manifests[i].writeDetails(&b)
+		details.SetText(b.String())
+	}
+	split := container.NewVSplit(list, container.NewScroll(details))
+	split.Offset = 0.6
+	return container.NewBorder(widget.NewLabel(fmt.Sprintf("%d runs", len(manifests))), nil, nil, nil, split)
+}
+
+// makeFindUI searches the catalog as the query is typed. The picked item can
+// be shown in its folder or restored to where it was swept from.
+func makeFindUI(search func(query string) []catalogItem, open func(item catalogItem), restore func(item catalogItem) (string, error)) fyne.CanvasObject {
+	items := search("")
+	selected := -1
+	summary := widget.NewLabel(fmt.Sprintf("%d items", len(items)))
+	openButton := widget.NewButton("Show in Folder", func() { open(items[selected]) })
+	restoreButton := widget.NewButton("Restore", nil)
+	openButton.Disable()
+	restoreButton.Disable()
+
+	list := widget.NewList(
+		func() int { return len(items) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) { o.(*widget.Label).SetText(items[i].String()) })
+	list.OnSelected = func(i widget.ListItemID) {
+		selected = i
+		openButton.Enable()
+		restoreButton.Enable()
+	}
+
+	query := widget.NewEntry()
+	query.SetPlaceHolder("Name, folder or part of a path")
+	query.OnChanged = func(s string) {
+		items = search(s)
+		selected = -1
+		list.UnselectAll()
+		openButton.Disable()
+		restoreButton.Disable()
+		summary.SetText(fmt.Sprintf("%d items", len(items)))
+		list.Refresh()
+	}
+	restoreButton.OnTapped = func() {
+		dst, err := restore(items[selected])
 		if err != nil {
-			return err
+			summary.SetText("Unable to restore: " + err.Error())
+			return
 		}
+		query.OnChanged(query.Text)
+		summary.SetText("Restored to " + dst)
 	}
-	return nil
+	return container.NewBorder(container.NewVBox(query, summary), container.NewHBox(layout.NewSpacer(), openButton, restoreButton), nil, nil, list)
 }
 
-func runIntervalToInt(text string) int {
-	switch text {
-	case "every minute":
-		return 1
-	case "every 5 minutes":
-		return 5
-	case "every 15 minutes":
-		return 15
-	case "every 30 minutes":
-		return 30
-	case "every 60 minutes":
-		return 60
-	case "every 4 hours":
-		return 240
-	case "every 12 hours":
-		return 720
+// makeRetentionUI previews the retention pass and runs it, deletions
+// included, when the button is pressed.
+func makeRetentionUI(plan retentionPlan, apply func() retentionPlan) fyne.CanvasObject {
+	summary := widget.NewLabel(fmt.Sprintf("%d to merge, %d to compress, %d to delete", plan.count(retentionMerge), plan.count(retentionBundle), plan.count(retentionDelete)))
+	list := widget.NewList(
+		func() int { return len(plan) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) { o.(*widget.Label).SetText(plan[i].String()) })
 
-	default:
-		return -1
+	var button *widget.Button
+	button = widget.NewButton("Clean Up Now", func() {
+		plan = apply()
+		done := map[retentionAction]int{}
+		failed := 0
+		for _, s := range plan {
+			if s.Error != "" {
+				failed++
+				continue
+			}
+			done[s.Action]++
+		}
+		summary.SetText(fmt.Sprintf("%d merged, %d compressed, %d deleted, %d failed", done[retentionMerge], done[retentionBundle], done[retentionDelete], failed))
+		list.Refresh()
+		button.Disable()
+	})
+	if len(plan) == 0 {
+		button.Disable()
+	}
+	return container.NewBorder(summary, button, nil, nil, list)
+}
+
+func makeUndoUI(report undoReport, err error) fyne.CanvasObject {
+	if err != nil {
+		return widget.NewLabel(fmt.Sprintf("Nothing was restored: %s", err))
+	}
+	lines := []string{}
+	for _, m := range report.Conflicts {
+		lines = append(lines, fmt.Sprintf("conflict %s (original location is taken)", m.Original))
+	}
+	for _, m := range report.Missing {
+		lines = append(lines, fmt.Sprintf("missing %s (no longer in the archive)", m.Archived))
+	}
+	for _, m := range report.Failed {
+		lines = append(lines, fmt.Sprintf("failed %s", m.Archived))
+	}
+	list := widget.NewList(
+		func() int { return len(lines) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) { o.(*widget.Label).SetText(lines[i]) })
+	return container.NewBorder(widget.NewLabel(report.String()), nil, nil, nil, list)
+}
+
+// getTargetPath returns the archive folder a sweep at now moves items into.
+// When the profile's folder template depends on the items themselves, this is
+// the part of it that all of them share.
+func getTargetPath(pref fyne.Preferences, profile sweepProfile, now time.Time) string {
+	archiveRoot := getArchiveRoot(pref)
+	t, err := profile.folderTemplate()
+	if err != nil {
+		return archiveRoot
+	}
+	return path.Join(archiveRoot, t.base(getTemplateVars(pref, profile, now)))
+}
+
+func getSweepOptions(pref fyne.Preferences, profile sweepProfile, dryRun bool, now time.Time) sweepOptions {
+	// Sweeps check the template before planning, a broken one is never used
+	folder, _ := profile.folderTemplate()
+	return sweepOptions{
+		DryRun:      dryRun,
+		Rules:       loadRules(pref),
+		Ignore:      loadIgnorePatterns(pref),
+		ArchiveRoot: getArchiveRoot(pref),
+		DateScheme:  profile.DateScheme,
+		Folder:      folder,
+		FolderVars:  getTemplateVars(pref, profile, now),
+		DateBasis:   profile.dateBasis(),
+		Collision:   collisionPolicy(pref.StringWithFallback("CollisionPolicy", string(collisionNumber))),
+		Duplicates:  duplicatePolicy(pref.StringWithFallback("DuplicatePolicy", string(duplicateOff))),
+		MinAge:      profile.minimumAge(),
+		AgeBasis:    ageBasis(profile.MinimumAgeBasis),
+		Now:         now,
+	}
+}
+
+// makeProfileMenu lists every profile as a menu item that calls action with it.
+func makeProfileMenu(profiles []sweepProfile, action func(sweepProfile)) *fyne.Menu {
+	items := []*fyne.MenuItem{}
+	for _, p := range profiles {
+		p := p
+		items = append(items, fyne.NewMenuItem(p.Name, func() { action(p) }))
+	}
+	return fyne.NewMenu("", items...)
+}
+
+// enforceRetention runs the retention pass in the background after a sweep,
+// leaving deletions for confirmation when the policy asks for it.
+func enforceRetention(pref fyne.Preferences, appName string) {
+	if _, err := runRetention(pref, appName, false); err != nil {
+		slog.Error("Failed to enforce retention policy.", slog.Any("error", err))
+	}
+}
+
+// checkProfile refuses to sweep a profile with a broken folder template or a
+// sweep location that holds the archive.
+func checkProfile(pref fyne.Preferences, profile sweepProfile) error {
+	if _, err := profile.folderTemplate(); err != nil {
+		return err
+	}
+	return checkSourceFolder(profile.SourcePath, getArchiveRoot(pref))
+}
+
+// sweepLock keeps scheduled and manual sweeps from running over each other.
+var sweepLock sync.Mutex
+
+// archiveLockFile is locked in the data folder by whichever process is
+// changing the archive.
+const archiveLockFile string = "archive.lock"
+
+// lockArchive keeps sweeps, undos, restores, retention and archive moves from
+// running over each other, within this process through sweepLock and across
+// processes, such as the tray app and the command line, through a lock on a
+// file in the data folder. The returned function releases both.
+func lockArchive(appName string) (func(), error) {
+	sweepLock.Lock()
+	f, err := openArchiveLock(appName)
+	if err != nil {
+		sweepLock.Unlock()
+		return nil, err
+	}
+	return func() {
+		f.Close()
+		sweepLock.Unlock()
+	}, nil
+}
+
+func openArchiveLock(appName string) (*os.File, error) {
+	dir := getDataDir(appName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path.Join(dir, archiveLockFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// previewSweep plans a sweep of the profile without touching any files.
+func previewSweep(pref fyne.Preferences, appName string, profile sweepProfile) (sweepPlan, error) {
+	if err := checkProfile(pref, profile); err != nil {
+		return sweepPlan{}, err
+	}
+	now := time.Now()
+	opts := getSweepOptions(pref, profile, true, now)
+	hashes, err := loadSweepHashes(pref, appName)
+	if err != nil {
+		return sweepPlan{}, err
+	}
+	opts.Hashes = hashes
+	return sweepFiles(os.DirFS(profile.SourcePath), profile.SourcePath, getTargetPath(pref, profile, now), opts)
+}
+
+// runSweep sweeps the profile source into today's archive folder and records
+// a manifest of the run so it shows in the history and can be undone. Runs
+// that started on their own and found nothing to do are not recorded. A
+// non-empty only limits the sweep to those entry names.
+func runSweep(pref fyne.Preferences, appName string, profile sweepProfile, only []string, trigger sweepTrigger) (sweepPlan, error) {
+	if err := checkProfile(pref, profile); err != nil {
+		return sweepPlan{}, err
+	}
+	unlock, err := lockArchive(appName)
+	if err != nil {
+		return sweepPlan{}, err
+	}
+	defer unlock()
+
+	sweptAt := time.Now()
+	targetPath := getTargetPath(pref, profile, sweptAt)
+
+	opts := getSweepOptions(pref, profile, false, sweptAt)
+	opts.Only = only
+	hashes, err := loadSweepHashes(pref, appName)
+	if err != nil {
+		return sweepPlan{}, err
+	}
+	opts.Hashes = hashes
+	plan, sweepErr := sweepFiles(os.DirFS(profile.SourcePath), profile.SourcePath, targetPath, opts)
+	if hashes != nil {
+		if err := hashes.save(); err != nil {
+			slog.Warn("Unable to save hash index.", slog.Any("error", err))
+		}
+	}
+
+	// Record the run even when it stopped part way, so the history shows why
+	// and whatever was moved can still be undone
+	m := newManifest(plan, profile.Name, profile.SourcePath, targetPath, sweptAt)
+	finishedAt := time.Now()
+	m.Trigger = trigger
+	m.FinishedAt = &finishedAt
+	if sweepErr != nil {
+		m.Error = sweepErr.Error()
+	}
+	if m.empty() && (trigger == triggerSchedule || trigger == triggerFileEvent) {
+		return plan, nil
+	}
+	if err := saveManifest(getManifestDir(appName), m); err != nil && sweepErr == nil {
+		return plan, err
 	}
+	updateCatalog(pref, appName, func(c *sweepCatalog) { c.addSweep(plan, m) })
+	return plan, sweepErr
 }
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+const (
+	manifestFolder  string = "manifests"
+	manifestExt     string = ".json"
+	manifestIDStamp string = "20060102T150405.000000000"
+)
+
+// movedItem is a single entry that a sweep moved into the archive.
+type movedItem struct {
+	Original string `json:"original"`
+	Archived string `json:"archived"`
+}
+
+// restoredItem is a single item put back from the archive on its own.
+type restoredItem struct {
+	Archived   string    `json:"archived"`
+	RestoredTo string    `json:"restoredTo"`
+	RestoredAt time.Time `json:"restoredAt"`
+}
+
+// failedItem is a single entry that a sweep was unable to handle.
+type failedItem struct {
+	Source string      `json:"source"`
+	Action sweepAction `json:"action"`
+	Error  string      `json:"error"`
+}
+
+// sweepManifest records a single sweep run, with every move it made so it can
+// be undone. Other passes over the archive, such as retention, are recorded
+// with their kind.
+type sweepManifest struct {
+	ID         string         `json:"id"`
+	Kind       string         `json:"kind,omitempty"`
+	SweptAt    time.Time      `json:"sweptAt"`
+	FinishedAt *time.Time     `json:"finishedAt,omitempty"`
+	Trigger    sweepTrigger   `json:"trigger,omitempty"`
+	Profile    string         `json:"profile"`
+	SourcePath string         `json:"sourcePath"`
+	TargetPath string         `json:"targetPath"`
+	Moves      []movedItem    `json:"moves"`
+	BytesMoved int64          `json:"bytesMoved,omitempty"`
+	Skipped    int            `json:"skipped,omitempty"`
+	Failed     []failedItem   `json:"failed,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Deleted    []string       `json:"deleted,omitempty"`
+	Trashed    []movedItem    `json:"trashed,omitempty"`
+	Restored   []restoredItem `json:"restored,omitempty"`
+	UndoneAt   *time.Time     `json:"undoneAt,omitempty"`
+}
+
+// undoReport is the outcome of replaying a manifest in reverse.
+type undoReport struct {
+	ManifestID string      `json:"manifestId"`
+	Restored   []movedItem `json:"restored"`
+	Conflicts  []movedItem `json:"conflicts"`
+	Missing    []movedItem `json:"missing"`
+	Failed     []movedItem `json:"failed"`
+}
+
+func (r undoReport) String() string {
+	return fmt.Sprintf("Restored %d, %d conflicts, %d missing, %d failed", len(r.Restored), len(r.Conflicts), len(r.Missing), len(r.Failed))
+}
+
+// write prints every item of the report with its outcome, one per line.
+func (r undoReport) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULT\tARCHIVED\tORIGINAL")
+	for _, group := range []struct {
+		label string
+		items []movedItem
+	}{{"restored", r.Restored}, {"conflict", r.Conflicts}, {"missing", r.Missing}, {"failed", r.Failed}} {
+		for _, m := range group.items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", group.label, m.Archived, m.Original)
+		}
+	}
+	return tw.Flush()
+}
+
+func getManifestDir(appName string) string {
+	return path.Join(getDataDir(appName), manifestFolder)
+}
+
+// newManifest records the moves and deletes of an executed plan that succeeded,
+// and the entries that were skipped or failed. Moves that left their source
+// behind count as both.
+func newManifest(plan sweepPlan, profile, sourcePath, targetPath string, sweptAt time.Time) sweepManifest {
+	m := sweepManifest{
+		ID:         sweptAt.UTC().Format(manifestIDStamp),
+		SweptAt:    sweptAt,
+		Profile:    profile,
+		SourcePath: sourcePath,
+		TargetPath: targetPath,
+		Moves:      []movedItem{},
+	}
+	for _, p := range plan {
+		if p.Error != "" {
+			m.Failed = append(m.Failed, failedItem{Source: p.Source, Action: p.Action, Error: p.Error})
+			// The archived copy of an item that could not be removed is still undoable
+			if !p.SourceKept {
+				continue
+			}
+		}
+		switch p.Action {
+		case actionSkip:
+			m.Skipped++
+		case actionMove:
+			m.Moves = append(m.Moves, movedItem{Original: p.Source, Archived: p.Destination})
+			m.BytesMoved += diskUsage(p.Destination)
+		case actionDelete:
+			m.Deleted = append(m.Deleted, p.Source)
+		case actionTrash:
+			m.Trashed = append(m.Trashed, movedItem{Original: p.Source, Archived: p.Destination})
+		}
+	}
+	return m
+}
+
+// saveManifest writes the manifest to dir, replacing any previous copy atomically.
+func saveManifest(dir string, m sweepManifest) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := path.Join(dir, m.ID+manifestExt)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func loadManifest(file string) (sweepManifest, error) {
+	var m sweepManifest
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// markManifestRestored adds an item restored on its own to the manifest of
+// the sweep that archived it.
+func markManifestRestored(dir, id string, item restoredItem) error {
+	m, err := loadManifest(path.Join(dir, id+manifestExt))
+	if err != nil {
+		return err
+	}
+	m.Restored = append(m.Restored, item)
+	return saveManifest(dir, m)
+}
+
+// wasRestored reports whether the item archived at p was restored on its own.
+func (m sweepManifest) wasRestored(p string) bool {
+	for _, r := range m.Restored {
+		if r.Archived == p {
+			return true
+		}
+	}
+	return false
+}
+
+// unrestored returns how many moved and trashed items have not been restored
+// on their own.
+func (m sweepManifest) unrestored() int {
+	n := 0
+	for _, item := range append(append([]movedItem{}, m.Moves...), m.Trashed...) {
+		if !m.wasRestored(item.Archived) {
+			n++
+		}
+	}
+	return n
+}
+
+// listManifests returns every manifest in dir, newest first.
+func listManifests(dir string) ([]sweepManifest, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), manifestExt) {
+			names = append(names, e.Name())
+		}
+	}
+	// IDs are timestamps so the names sort chronologically
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	manifests := []sweepManifest{}
+	for _, n := range names {
+		m, err := loadManifest(path.Join(dir, n))
+		if err != nil {
+			slog.Warn("Unable to read sweep manifest.", slog.Any("error", err), slog.String("file", n))
+			continue
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, nil
+}
+
+// undoSweep undoes the most recent sweep of the app and drops what it put back
+// from the catalog.
+func undoSweep(pref fyne.Preferences, appName string) (undoReport, error) {
+	unlock, err := lockArchive(appName)
+	if err != nil {
+		return undoReport{}, err
+	}
+	defer unlock()
+
+	report, err := undoLastSweep(getManifestDir(appName))
+	if len(report.Restored) > 0 {
+		updateCatalog(pref, appName, func(c *sweepCatalog) {
+			for _, m := range report.Restored {
+				c.forget(m.Archived)
+			}
+		})
+	}
+	return report, err
+}
+
+// undoLastSweep moves everything recorded by the most recent sweep that has not
+// been undone back to where it came from. Items whose original location is
+// taken again or whose archived copy has disappeared are left alone and reported.
+// Items already restored on their own are skipped. The sweep only counts as
+// undone once every item is back, until then the next undo retries the rest.
+func undoLastSweep(dir string) (undoReport, error) {
+	report := undoReport{}
+
+	manifests, err := listManifests(dir)
+	if err != nil {
+		return report, err
+	}
+
+	var last *sweepManifest
+	for i := range manifests {
+		if manifests[i].Kind == "" && manifests[i].UndoneAt == nil && manifests[i].unrestored() > 0 {
+			last = &manifests[i]
+			break
+		}
+	}
+	if last == nil {
+		return report, errors.New("no sweep to undo")
+	}
+	report.ManifestID = last.ID
+	now := time.Now()
+
+	// Replay in reverse so nested moves unwind in the opposite order they were made
+	items := append(append([]movedItem{}, last.Moves...), last.Trashed...)
+	for i := len(items) - 1; i >= 0; i-- {
+		m := items[i]
+		if last.wasRestored(m.Archived) {
+			continue
+		}
+		if _, err := os.Lstat(m.Archived); errors.Is(err, os.ErrNotExist) {
+			report.Missing = append(report.Missing, m)
+			continue
+		}
+		if _, err := os.Lstat(m.Original); err == nil {
+			report.Conflicts = append(report.Conflicts, m)
+			continue
+		}
+		if err := os.MkdirAll(path.Dir(m.Original), os.ModePerm); err != nil {
+			slog.Warn("Failed to restore file.", slog.Any("error", err), slog.String("file", m.Archived))
+			report.Failed = append(report.Failed, m)
+			continue
+		}
+		if err := moveFile(m.Archived, m.Original); errors.Is(err, errSourceKept) {
+			slog.Warn("Restored file, but part of it is left in the archive.", slog.Any("error", err), slog.String("file", m.Archived))
+		} else if err != nil {
+			slog.Warn("Failed to restore file.", slog.Any("error", err), slog.String("file", m.Archived))
+			report.Failed = append(report.Failed, m)
+			continue
+		}
+		if i >= len(last.Moves) {
+			if err := removeTrashInfo(m.Archived); err != nil {
+				slog.Warn("Unable to remove trash info file.", slog.Any("error", err), slog.String("file", m.Archived))
+			}
+		}
+		report.Restored = append(report.Restored, m)
+		last.Restored = append(last.Restored, restoredItem{Archived: m.Archived, RestoredTo: m.Original, RestoredAt: now})
+	}
+
+	if last.unrestored() == 0 {
+		last.UndoneAt = &now
+	}
+	if err := saveManifest(dir, *last); err != nil {
+		return report, err
+	}
+	slog.Info("Undo completed.", slog.String("manifest", last.ID), slog.Int("restoredFileCount", len(report.Restored)), slog.Int("conflictCount", len(report.Conflicts)), slog.Int("missingFileCount", len(report.Missing)), slog.Int("fileErrorCount", len(report.Failed)))
+	return report, nil
+}
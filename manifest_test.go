@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestNewManifestSourceKept(t *testing.T) {
+	plan := sweepPlan{
+		{Source: "/d/a.txt", Destination: "/t/a.txt", Action: actionMove},
+		{Source: "/d/b.txt", Destination: "/t/b.txt", Action: actionMove, Error: "copied, but unable to remove the original", SourceKept: true},
+		{Source: "/d/c.txt", Destination: "/t/c.txt", Action: actionMove, Error: "permission denied"},
+	}
+	m := newManifest(plan, "Desktop", "/d", "/t", time.Now())
+	if len(m.Moves) != 2 || m.Moves[1].Archived != "/t/b.txt" {
+		t.Errorf("moves = %v, want a.txt and the kept b.txt", m.Moves)
+	}
+	if len(m.Failed) != 2 {
+		t.Errorf("failed = %v, want b.txt and c.txt", m.Failed)
+	}
+}
+
+func TestUndoLastSweep(t *testing.T) {
+	dir := t.TempDir()
+	desktop, archive, manifests := path.Join(dir, "Desktop"), path.Join(dir, "Archive"), path.Join(dir, "manifests")
+	writeTree(t, archive, map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c", "sub/d.txt": "d"})
+	// b.txt has been replaced on the desktop since the sweep
+	writeTree(t, desktop, map[string]string{"b.txt": "new b"})
+	moved := func(name string) movedItem {
+		return movedItem{Original: path.Join(desktop, name), Archived: path.Join(archive, name)}
+	}
+	older := sweepManifest{ID: "20260101T000000Z", SweptAt: time.Now().Add(-time.Hour), Moves: []movedItem{moved("sub")}}
+	last := sweepManifest{
+		ID:       "20260102T000000Z",
+		SweptAt:  time.Now(),
+		Moves:    []movedItem{moved("a.txt"), moved("b.txt"), moved("c.txt")},
+		Restored: []restoredItem{{Archived: path.Join(archive, "c.txt"), RestoredTo: path.Join(desktop, "c.txt")}},
+	}
+	for _, m := range []sweepManifest{older, last} {
+		if err := saveManifest(manifests, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := undoLastSweep(manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ManifestID != last.ID || len(report.Restored) != 1 || len(report.Conflicts) != 1 {
+		t.Fatalf("first undo = %+v, want a.txt restored and b.txt in conflict", report)
+	}
+	if data, err := os.ReadFile(path.Join(desktop, "a.txt")); err != nil || string(data) != "a" {
+		t.Errorf("a.txt = %q, %v, want it back on the desktop", data, err)
+	}
+	if _, err := os.Lstat(path.Join(desktop, "c.txt")); err == nil {
+		t.Error("c.txt was restored on its own and should be skipped")
+	}
+	m, err := loadManifest(path.Join(manifests, last.ID+manifestExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.UndoneAt != nil || m.unrestored() != 1 {
+		t.Errorf("after a partial undo: undone %v with %d unrestored, want b.txt left to undo", m.UndoneAt, m.unrestored())
+	}
+
+	// Once the way is clear the same sweep is undone the rest of the way
+	if err := os.Remove(path.Join(desktop, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	report, err = undoLastSweep(manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ManifestID != last.ID || len(report.Restored) != 1 || report.Restored[0].Archived != path.Join(archive, "b.txt") {
+		t.Fatalf("second undo = %+v, want only b.txt restored", report)
+	}
+	if m, err = loadManifest(path.Join(manifests, last.ID+manifestExt)); err != nil || m.UndoneAt == nil {
+		t.Errorf("after the second undo: undone %v, %v, want the sweep marked undone", m.UndoneAt, err)
+	}
+
+	report, err = undoLastSweep(manifests)
+	if err != nil || report.ManifestID != older.ID || len(report.Restored) != 1 {
+		t.Fatalf("third undo = %+v, %v, want the older sweep", report, err)
+	}
+	if data, err := os.ReadFile(path.Join(desktop, "sub/d.txt")); err != nil || string(data) != "d" {
+		t.Errorf("sub/d.txt = %q, %v, want the folder back", data, err)
+	}
+	if _, err := undoLastSweep(manifests); err == nil {
+		t.Error("undo with every sweep undone should fail")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"fyne.io/fyne/v2"
+	"github.com/adrg/xdg"
+)
+
+// schemaVersionKey stores the version of the last migration the preferences had.
+const schemaVersionKey string = "SchemaVersion"
+
+// prefMigration upgrades preferences to version and reports whether it changed
+// anything.
+type prefMigration struct {
+	version     int
+	description string
+	migrate     func(pref fyne.Preferences) bool
+}
+
+// prefMigrations run in order at startup, each of them once. New ones go at
+// the end with the next version, released ones are never changed.
+var prefMigrations = []prefMigration{
+	{1, "build a sweep profile from the settings of before profiles", migrateLegacyProfile},
+	{2, "convert run intervals to schedules", migrateRunIntervals},
+	{3, "rename TargetFolderSeperator to TargetFolderSeparator", migrateSeparatorKey},
+	{4, "drop the first run flag", func(pref fyne.Preferences) bool {
+		return removePrefs(pref, "FirstRun")
+	}},
+}
+
+// legacyProfileKeys are the settings of versions before profiles.
+var legacyProfileKeys = []string{"SourcePath", "TargetFolderLabel", "TargetFolderDateScheme", "RunInterval", "RunIntervalMinutes", "MinimumAge", "MinimumAgeUnit", "MinimumAgeBasis"}
+
+func latestSchemaVersion() int {
+	return prefMigrations[len(prefMigrations)-1].version
+}
+
+// migratePreferences upgrades preferences saved by older versions and then
+// stores the default of every setting that is still missing.
+func migratePreferences(pref fyne.Preferences) {
+	from := pref.Int(schemaVersionKey)
+	if from > latestSchemaVersion() {
+		slog.Warn("Preferences are from a newer version, leaving them as they are.", slog.Int("version", from), slog.Int("latestVersion", latestSchemaVersion()))
+	} else {
+		for _, m := range prefMigrations {
+			if m.version <= from {
+				continue
+			}
+			if m.migrate(pref) {
+				slog.Info("Migrated preferences.", slog.Int("version", m.version), slog.String("migration", m.description))
+			}
+			pref.SetInt(schemaVersionKey, m.version)
+		}
+	}
+	fillDefaults(pref)
+}
+
+// prefDefaults are the settings every installation has.
+func prefDefaults() map[string]any {
+	return map[string]any{
+		"AppName":               appNameDefault,
+		"AppFolder":             appNameDefault,
+		"HomeDir":               xdg.Home,
+		"TargetFolderSeparator": "-",
+		"CollisionPolicy":       string(collisionNumber),
+		"Profiles":              []sweepProfile{defaultProfile()},
+		"AutoLaunchApp":         false,
+	}
+}
+
+// fillDefaults stores the default of each setting that is not set, leaving
+// the others alone. Settings the team baseline decides count as set so the
+// baseline shows through.
+func fillDefaults(pref fyne.Preferences) {
+	for key, value := range prefDefaults() {
+		if prefIsSet(pref, key, value) {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			pref.SetString(key, v)
+		case bool:
+			pref.SetBool(key, v)
+		case []sweepProfile:
+			saveProfiles(pref, v)
+		}
+		slog.Info("Stored default setting.", slog.String("key", key))
+	}
+}
+
+// prefIsSet reports whether key holds a value of the same type as like.
+// Preferences only offer fallbacks, so a key is set when two different
+// fallbacks give the same value.
+func prefIsSet(pref fyne.Preferences, key string, like any) bool {
+	switch like.(type) {
+	case bool:
+		return pref.BoolWithFallback(key, false) == pref.BoolWithFallback(key, true)
+	case int:
+		return pref.IntWithFallback(key, 0) == pref.IntWithFallback(key, 1)
+	default:
+		return pref.StringWithFallback(key, "a") == pref.StringWithFallback(key, "b")
+	}
+}
+
+// removePrefs removes the keys that are set and reports whether there were any.
+func removePrefs(pref fyne.Preferences, keys ...string) bool {
+	removed := false
+	for _, key := range keys {
+		if prefIsSet(pref, key, "") || prefIsSet(pref, key, 0) || prefIsSet(pref, key, false) {
+			pref.RemoveValue(key)
+			removed = true
+		}
+	}
+	return removed
+}
+
+// migrateLegacyProfile turns the settings of versions before profiles into a
+// single profile, unless there are profiles already.
+func migrateLegacyProfile(pref fyne.Preferences) bool {
+	legacy := false
+	for _, key := range []string{"SourcePath", "TargetFolderLabel", "TargetFolderDateScheme", "RunInterval"} {
+		legacy = legacy || prefIsSet(pref, key, "")
+	}
+	if !legacy {
+		return removePrefs(pref, legacyProfileKeys...)
+	}
+	if !prefIsSet(pref, "Profiles", "") {
+		p := defaultProfile()
+		p.SourcePath = pref.StringWithFallback("SourcePath", p.SourcePath)
+		p.Label = pref.StringWithFallback("TargetFolderLabel", p.Label)
+		p.DateScheme = pref.StringWithFallback("TargetFolderDateScheme", p.DateScheme)
+		p.RunInterval = pref.String("RunInterval")
+		p.MinimumAge = pref.Int("MinimumAge")
+		p.MinimumAgeUnit = pref.StringWithFallback("MinimumAgeUnit", p.MinimumAgeUnit)
+		p.MinimumAgeBasis = pref.StringWithFallback("MinimumAgeBasis", p.MinimumAgeBasis)
+		saveProfiles(pref, []sweepProfile{p})
+		slog.Info("Created sweep profile from existing settings.", slog.String("profile", p.Name))
+	}
+	removePrefs(pref, legacyProfileKeys...)
+	return true
+}
+
+// migrateRunIntervals replaces the fixed run intervals of profiles with the
+// equivalent cron schedules.
+func migrateRunIntervals(pref fyne.Preferences) bool {
+	data := pref.String("Profiles")
+	if data == "" {
+		return false
+	}
+	profiles := []sweepProfile{}
+	if err := json.Unmarshal([]byte(data), &profiles); err != nil {
+		slog.Error("Unable to read sweep profiles.", slog.Any("error", err))
+		return false
+	}
+	migrated := false
+	for i := range profiles {
+		migrated = profiles[i].migrateRunInterval() || migrated
+	}
+	if migrated {
+		saveProfiles(pref, profiles)
+	}
+	return migrated
+}
+
+// migrateSeparatorKey moves the folder separator to the correctly spelled key.
+// Versions that stored the misspelled key had no other, so its value is kept.
+func migrateSeparatorKey(pref fyne.Preferences) bool {
+	if !prefIsSet(pref, "TargetFolderSeperator", "") {
+		return false
+	}
+	pref.SetString("TargetFolderSeparator", pref.String("TargetFolderSeperator"))
+	pref.RemoveValue("TargetFolderSeperator")
+	return true
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+// openTestPreferences opens a preferences file holding data.
+func openTestPreferences(t *testing.T, data string) *filePreferences {
+	t.Helper()
+	file := path.Join(t.TempDir(), "preferences.json")
+	if err := os.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pref, err := openPreferences(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pref
+}
+
+func TestMigrateLegacyPreferences(t *testing.T) {
+	pref := openTestPreferences(t, `{
+		"SourcePath": "/home/a/Desktop",
+		"TargetFolderLabel": "Swept",
+		"TargetFolderDateScheme": "2006-01",
+		"RunInterval": "every 24 hours",
+		"MinimumAge": 5,
+		"MinimumAgeUnit": "days",
+		"TargetFolderSeperator": "_",
+		"FirstRun": true,
+		"CollisionPolicy": "skip"
+	}`)
+	migratePreferences(pref)
+
+	profiles := loadProfiles(pref)
+	if len(profiles) != 1 {
+		t.Fatalf("profiles = %+v, want one built from the old settings", profiles)
+	}
+	p := profiles[0]
+	if p.SourcePath != "/home/a/Desktop" || p.Label != "Swept" || p.DateScheme != "2006-01" || p.MinimumAge != 5 || p.MinimumAgeUnit != "days" {
+		t.Errorf("profile = %+v, want the old settings", p)
+	}
+	if p.Schedule != "0 0 * * *" || p.RunInterval != "" {
+		t.Errorf("profile schedule = %q, run interval %q, want the interval converted", p.Schedule, p.RunInterval)
+	}
+	for _, key := range append([]string{"TargetFolderSeperator", "FirstRun"}, legacyProfileKeys...) {
+		if pref.has(key) {
+			t.Errorf("%s is still set", key)
+		}
+	}
+	if v := pref.String("TargetFolderSeparator"); v != "_" {
+		t.Errorf("TargetFolderSeparator = %q, want _ from the misspelled key", v)
+	}
+	if v := pref.String("CollisionPolicy"); v != "skip" {
+		t.Errorf("CollisionPolicy = %q, want the stored value kept", v)
+	}
+	if v := pref.Int(schemaVersionKey); v != latestSchemaVersion() {
+		t.Errorf("%s = %d, want %d", schemaVersionKey, v, latestSchemaVersion())
+	}
+
+	// Running again changes nothing
+	before := pref.String("Profiles")
+	migratePreferences(pref)
+	if after := pref.String("Profiles"); after != before {
+		t.Errorf("second migration changed profiles from %s to %s", before, after)
+	}
+
+	reopened, err := openPreferences(pref.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := reopened.Int(schemaVersionKey); v != latestSchemaVersion() {
+		t.Errorf("saved %s = %d, want %d", schemaVersionKey, v, latestSchemaVersion())
+	}
+}
+
+func TestMigrateKeepsProfiles(t *testing.T) {
+	pref := openTestPreferences(t, `{
+		"Profiles": "[{\"name\":\"Downloads\",\"sourcePath\":\"/home/a/Downloads\",\"label\":\"Archive\",\"dateScheme\":\"2006-01-02\",\"runInterval\":\"every 15 minutes\"}]",
+		"SourcePath": "/home/a/Desktop"
+	}`)
+	migratePreferences(pref)
+	profiles := loadProfiles(pref)
+	if len(profiles) != 1 || profiles[0].Name != "Downloads" || profiles[0].Schedule != "*/15 * * * *" {
+		t.Errorf("profiles = %+v, want Downloads kept with its interval converted", profiles)
+	}
+	if pref.has("SourcePath") {
+		t.Error("SourcePath is still set")
+	}
+}
+
+func TestMigrateFreshPreferences(t *testing.T) {
+	pref := openTestPreferences(t, `{}`)
+	migratePreferences(pref)
+	for key := range prefDefaults() {
+		if !pref.has(key) {
+			t.Errorf("default of %s was not stored", key)
+		}
+	}
+	if profiles := loadProfiles(pref); len(profiles) != 1 || profiles[0].Name != defaultProfile().Name {
+		t.Errorf("profiles = %+v, want the default profile", profiles)
+	}
+	if v := pref.Int(schemaVersionKey); v != latestSchemaVersion() {
+		t.Errorf("%s = %d, want %d", schemaVersionKey, v, latestSchemaVersion())
+	}
+}
+
+func TestMigrateNewerPreferences(t *testing.T) {
+	pref := openTestPreferences(t, `{"SchemaVersion": 99, "TargetFolderSeperator": "_", "FirstRun": true}`)
+	migratePreferences(pref)
+	if v := pref.Int(schemaVersionKey); v != 99 {
+		t.Errorf("%s = %d, want 99 left alone", schemaVersionKey, v)
+	}
+	if !pref.has("TargetFolderSeperator") || !pref.has("FirstRun") {
+		t.Error("settings of a newer version should not be migrated")
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const partialPrefix string = ".deskclean-partial-"
+
+// errSourceKept means src was copied to dst and verified but could not be
+// removed afterwards, so the item is at its destination and, at least in part,
+// still at its source.
+var errSourceKept = errors.New("copied, but unable to remove the original")
+
+// moveFile renames src to dst. When they are on different filesystems it falls
+// back to copying src next to dst, verifying the copy and only then deleting
+// src, so a crash at any point leaves at least one complete copy behind.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+
+	slog.Debug("Source and destination are on different filesystems, copying.", slog.String("file", src), slog.String("destination", dst))
+	return moveByCopy(src, dst)
+}
+
+// moveByCopy moves src to dst by way of a verified copy.
+func moveByCopy(src, dst string) error {
+	// Copy under a hidden name so a half written copy is never mistaken for the real one
+	tmp := path.Join(path.Dir(dst), partialPrefix+path.Base(dst))
+	// A copy left by an interrupted move may be all there is of an item, so it is never removed here
+	if _, err := os.Lstat(tmp); err == nil {
+		return fmt.Errorf("%s is left from an interrupted move, check it and remove it to try again", tmp)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	sums, err := copyTree(src, tmp)
+	if err == nil {
+		err = verifyTree(tmp, sums)
+	}
+	if err != nil {
+		if rmErr := os.RemoveAll(tmp); rmErr != nil {
+			slog.Warn("Unable to remove partial copy.", slog.Any("error", rmErr), slog.String("file", tmp))
+		}
+		return fmt.Errorf("copy %s: %w", src, err)
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	if err := syncDir(path.Dir(dst)); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("%w: %w", errSourceKept, err)
+	}
+	return nil
+}
+
+// fileSum is the size and checksum of a copied file, keyed by its path relative
+// to the root of the copy.
+type fileSum struct {
+	size int64
+	sum  []byte
+}
+
+// copyTree copies a file or directory tree from src to dst keeping mode bits,
+// modification times and extended attributes where the platform allows.
+func copyTree(src, dst string) (map[string]fileSum, error) {
+	sums := map[string]fileSum{}
+	dirs := []string{}
+	dirTimes := map[string]time.Time{}
+
+	err := filepath.WalkDir(src, func(from string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		p, err := filepath.Rel(src, from)
+		if err != nil {
+			return err
+		}
+		p = filepath.ToSlash(p)
+		to := path.Join(dst, p)
+		info, err := os.Lstat(from)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			if err := os.Mkdir(to, info.Mode().Perm()|0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, p)
+			dirTimes[p] = info.ModTime()
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(from)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, to)
+		case info.Mode().IsRegular():
+			sum, err := copyFile(from, to, info)
+			if err != nil {
+				return err
+			}
+			sums[p] = fileSum{size: info.Size(), sum: sum}
+		default:
+			return fmt.Errorf("%s: cannot copy %s", from, info.Mode().Type())
+		}
+
+		if err := copyXattrs(from, to); err != nil {
+			slog.Debug("Unable to copy extended attributes.", slog.Any("error", err), slog.String("file", from))
+		}
+		return nil
+	})
+	if err != nil {
+		return sums, err
+	}
+
+	// Directory modes and times go last, deepest first, since filling them changes both
+	for i := len(dirs) - 1; i >= 0; i-- {
+		p := dirs[i]
+		info, err := os.Stat(path.Join(src, p))
+		if err != nil {
+			return sums, err
+		}
+		if err := os.Chmod(path.Join(dst, p), info.Mode()); err != nil {
+			return sums, err
+		}
+		if err := os.Chtimes(path.Join(dst, p), time.Time{}, dirTimes[p]); err != nil {
+			return sums, err
+		}
+	}
+	return sums, nil
+}
+
+// copyFile copies a single regular file, flushing it to disk, and returns the
+// checksum of what was read from src.
+func copyFile(src, dst string, info fs.FileInfo) ([]byte, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(out, io.TeeReader(in, h)); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(dst, info.Mode()); err != nil {
+		return nil, err
+	}
+	if err := os.Chtimes(dst, time.Time{}, info.ModTime()); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// verifyTree re-reads every copied file under root and checks it against the
+// size and checksum of its source.
+func verifyTree(root string, sums map[string]fileSum) error {
+	for p, want := range sums {
+		file := path.Join(root, p)
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if info.Size() != want.size {
+			return fmt.Errorf("%s: copied %d bytes, expected %d", file, info.Size(), want.size)
+		}
+		sum, err := hashFile(file)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(sum, want.sum) {
+			return fmt.Errorf("%s: checksum mismatch after copy", file)
+		}
+	}
+	return nil
+}
+
+func hashFile(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
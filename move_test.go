@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTree creates files under root from a map of relative paths to contents.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for p, data := range files {
+		file := path.Join(root, p)
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	dir := t.TempDir()
+	src := path.Join(dir, "src")
+	writeTree(t, src, map[string]string{"a.txt": "alpha", "sub/b.txt": "beta", "sub/deeper/c.txt": ""})
+	if err := os.Chmod(path.Join(src, "a.txt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", path.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	stamp := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	for _, p := range []string{"a.txt", "sub/b.txt", "sub"} {
+		if err := os.Chtimes(path.Join(src, p), time.Time{}, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := path.Join(dir, "dst")
+	sums, err := copyTree(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != 3 {
+		t.Errorf("copyTree returned %d sums, want 3", len(sums))
+	}
+	if err := verifyTree(dst, sums); err != nil {
+		t.Errorf("verifyTree of a fresh copy: %v", err)
+	}
+
+	if data, err := os.ReadFile(path.Join(dst, "sub/b.txt")); err != nil || string(data) != "beta" {
+		t.Errorf("sub/b.txt = %q, %v, want beta", data, err)
+	}
+	if info, err := os.Stat(path.Join(dst, "a.txt")); err != nil || info.Mode().Perm() != 0600 || !info.ModTime().Equal(stamp) {
+		t.Errorf("a.txt = %v, want mode 0600 and time %v", info, stamp)
+	}
+	if info, err := os.Stat(path.Join(dst, "sub")); err != nil || !info.ModTime().Equal(stamp) {
+		t.Errorf("sub = %v, want time %v", info, stamp)
+	}
+	if target, err := os.Readlink(path.Join(dst, "link")); err != nil || target != "a.txt" {
+		t.Errorf("link = %q, %v, want a link to a.txt", target, err)
+	}
+
+	// A copy into an existing file fails rather than overwriting it
+	if _, err := copyTree(path.Join(src, "a.txt"), path.Join(dst, "sub/b.txt")); err == nil {
+		t.Error("copyTree over an existing file should fail")
+	}
+}
+
+func TestVerifyTree(t *testing.T) {
+	dir := t.TempDir()
+	src := path.Join(dir, "src")
+	writeTree(t, src, map[string]string{"a.txt": "alpha", "b.txt": "beta"})
+	dst := path.Join(dir, "dst")
+	sums, err := copyTree(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(root string) error
+		err    string
+	}{
+		{"changed content", func(root string) error { return os.WriteFile(path.Join(root, "a.txt"), []byte("ALPHA"), 0644) }, "checksum mismatch"},
+		{"changed size", func(root string) error { return os.WriteFile(path.Join(root, "a.txt"), []byte("alp"), 0644) }, "copied 3 bytes, expected 5"},
+		{"missing file", func(root string) error { return os.Remove(path.Join(root, "b.txt")) }, "no such file"},
+	}
+	for _, tt := range tests {
+		root := path.Join(dir, strings.ReplaceAll(tt.name, " ", "-"))
+		if _, err := copyTree(src, root); err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.change(root); err != nil {
+			t.Fatal(err)
+		}
+		if err := verifyTree(root, sums); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: verifyTree error = %v, want one containing %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestMoveByCopy(t *testing.T) {
+	dir := t.TempDir()
+	src := path.Join(dir, "Desktop", "project")
+	writeTree(t, src, map[string]string{"notes.txt": "notes", "img/a.png": "png"})
+	dst := path.Join(dir, "Archive", "project")
+	if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moveByCopy(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(src); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("source still exists after the move: %v", err)
+	}
+	if data, err := os.ReadFile(path.Join(dst, "img/a.png")); err != nil || string(data) != "png" {
+		t.Errorf("img/a.png = %q, %v, want png", data, err)
+	}
+	if _, err := os.Lstat(path.Join(path.Dir(dst), partialPrefix+"project")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("partial copy left behind: %v", err)
+	}
+}
+
+func TestMoveByCopyKeepsPartialCopy(t *testing.T) {
+	dir := t.TempDir()
+	src := path.Join(dir, "report.pdf")
+	writeTree(t, dir, map[string]string{"report.pdf": "new", "Archive/" + partialPrefix + "report.pdf": "only copy"})
+	dst := path.Join(dir, "Archive", "report.pdf")
+
+	err := moveByCopy(src, dst)
+	if err == nil || !strings.Contains(err.Error(), "interrupted move") {
+		t.Fatalf("moveByCopy over a partial copy = %v, want an interrupted move error", err)
+	}
+	if data, err := os.ReadFile(path.Join(dir, "Archive", partialPrefix+"report.pdf")); err != nil || string(data) != "only copy" {
+		t.Errorf("partial copy = %q, %v, want it untouched", data, err)
+	}
+	if _, err := os.Lstat(src); err != nil {
+		t.Errorf("source should be left alone: %v", err)
+	}
+}
+
+func TestMoveByCopySourceKept(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can remove files from read only folders")
+	}
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"Desktop/report.pdf": "report"})
+	desktop := path.Join(dir, "Desktop")
+	if err := os.Chmod(desktop, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(desktop, 0755)
+
+	dst := path.Join(dir, "report.pdf")
+	if err := moveByCopy(path.Join(desktop, "report.pdf"), dst); !errors.Is(err, errSourceKept) {
+		t.Fatalf("moveByCopy = %v, want errSourceKept", err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "report" {
+		t.Errorf("destination = %q, %v, want the copy", data, err)
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "alpha"})
+	if err := moveFile(path.Join(dir, "a.txt"), path.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path.Join(dir, "b.txt")); err != nil || string(data) != "alpha" {
+		t.Errorf("b.txt = %q, %v, want alpha", data, err)
+	}
+	if err := moveFile(path.Join(dir, "a.txt"), path.Join(dir, "c.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("moving a missing file = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, returned by MoveFileEx across volumes.
+const errorNotSameDevice syscall.Errno = 17
+
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
+
+// syncDir does nothing on Windows, where directories cannot be flushed and
+// renames are journaled by NTFS.
+func syncDir(dir string) error {
+	return nil
+}
+
+func deviceOf(p string) (uint64, error) {
+	return 0, errors.New("device numbers are not available on Windows")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// notifyPolicy decides which sweeps are announced with a desktop notification.
+type notifyPolicy string
+
+const (
+	notifyAlways notifyPolicy = "always"
+	notifyErrors notifyPolicy = "errors only"
+	notifyNever  notifyPolicy = "never"
+
+	clockLayout string = "15:04"
+)
+
+var allowedNotifyPolicies = []string{string(notifyAlways), string(notifyErrors), string(notifyNever)}
+
+// parseClock returns the minutes since midnight of a time such as "22:00".
+func parseClock(text string) (int, error) {
+	t, err := time.Parse(clockLayout, text)
+	if err != nil {
+		return 0, fmt.Errorf("expected a time such as 22:00, got %q", text)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// inQuietHours reports whether now falls between start and end, which may run
+// past midnight. An unset or invalid window is never quiet.
+func inQuietHours(now time.Time, start, end string) bool {
+	if start == "" || end == "" {
+		return false
+	}
+	s, err := parseClock(start)
+	if err != nil {
+		return false
+	}
+	e, err := parseClock(end)
+	if err != nil {
+		return false
+	}
+	m := now.Hour()*60 + now.Minute()
+	if s <= e {
+		return m >= s && m < e
+	}
+	return m >= s || m < e
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// sweepNotification summarizes a sweep, such as "Moved 14 items to
+// 2026-10-16-Archive, 2 failed", and reports whether anything went wrong.
+// Sweeps that found nothing to do return nil.
+func sweepNotification(profile sweepProfile, plan sweepPlan, err error) (*fyne.Notification, bool) {
+	title := profile.Name + " sweep"
+	if err != nil {
+		return fyne.NewNotification(title+" failed", err.Error()), true
+	}
+
+	counts := map[sweepAction]int{}
+	for _, m := range plan {
+		if m.Error == "" {
+			counts[m.Action]++
+		}
+	}
+	failed := plan.countFailed()
+	if counts[actionMove]+counts[actionDelete]+counts[actionTrash]+failed == 0 {
+		return nil, false
+	}
+
+	content := "Moved " + plural(counts[actionMove], "item")
+	// Items dated by their files or sent on by rules can land in several folders
+	switch folders := movedInto(plan); len(folders) {
+	case 0:
+	case 1:
+		content += " to " + path.Base(folders[0])
+	default:
+		content += fmt.Sprintf(" to %d folders", len(folders))
+	}
+	if counts[actionDelete] > 0 {
+		content += fmt.Sprintf(", %d deleted", counts[actionDelete])
+	}
+	if counts[actionTrash] > 0 {
+		content += fmt.Sprintf(", %d trashed", counts[actionTrash])
+	}
+	if failed > 0 {
+		content += fmt.Sprintf(", %d failed", failed)
+	}
+	return fyne.NewNotification(title, content), failed > 0
+}
+
+// movedInto returns the folders the plan moved items into, in order.
+func movedInto(plan sweepPlan) []string {
+	folders := []string{}
+	for _, m := range plan {
+		if m.Action != actionMove || m.Error != "" {
+			continue
+		}
+		if dir := path.Dir(m.Destination); !slices.Contains(folders, dir) {
+			folders = append(folders, dir)
+		}
+	}
+	return folders
+}
+
+// notifySweep announces a finished sweep with send when the notification
+// settings allow it.
+func notifySweep(pref fyne.Preferences, profile sweepProfile, plan sweepPlan, err error, send func(n *fyne.Notification)) {
+	n, failed := sweepNotification(profile, plan, err)
+	if n == nil {
+		return
+	}
+	switch notifyPolicy(pref.StringWithFallback("NotifyPolicy", string(notifyErrors))) {
+	case notifyNever:
+		return
+	case notifyErrors:
+		if !failed {
+			return
+		}
+	}
+	if inQuietHours(time.Now(), pref.String("QuietHoursStart"), pref.String("QuietHoursEnd")) {
+		slog.Debug("Notification held back during quiet hours.", slog.String("profile", profile.Name))
+		return
+	}
+	send(n)
+}
@@ -0,0 +1,16 @@
+package main
+
+import "github.com/godbus/dbus/v5"
+
+// sendDesktopNotification shows the notification through the
+// org.freedesktop.Notifications service of the session bus, for when there is
+// no Fyne app to send it.
+func sendDesktopNotification(appName, title, content string) error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	obj := conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications")
+	return obj.Call("org.freedesktop.Notifications.Notify", 0, appName, uint32(0),
+		"", title, content, []string{}, map[string]dbus.Variant{}, int32(-1)).Err
+}
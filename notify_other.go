@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func sendDesktopNotification(appName, title, content string) error {
+	return errors.New("notifications need the tray app on this platform")
+}
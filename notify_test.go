@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSweepNotification(t *testing.T) {
+	profile := sweepProfile{Name: "Desktop"}
+	moved := func(src, dst string) plannedMove {
+		return plannedMove{Source: src, Destination: dst, Action: actionMove}
+	}
+	tests := []struct {
+		name    string
+		plan    sweepPlan
+		err     error
+		content string
+		failed  bool
+	}{
+		{"one folder", sweepPlan{moved("/d/a", "/t/2020-06-01-Archive/a"), moved("/d/b", "/t/2020-06-01-Archive/b")}, nil, "Moved 2 items to 2020-06-01-Archive", false},
+		{"dated by file", sweepPlan{moved("/d/a", "/t/2020-06-01-Archive/a"), moved("/d/b", "/t/2026-10-16-Archive/b")}, nil, "Moved 2 items to 2 folders", false},
+		{"deleted only", sweepPlan{{Source: "/d/a.tmp", Action: actionDelete}}, nil, "Moved 0 items, 1 deleted", false},
+		{"failed", sweepPlan{moved("/d/a", "/t/x/a"), {Source: "/d/b", Destination: "/t/x/b", Action: actionMove, Error: "denied"}}, nil, "Moved 1 item to x, 1 failed", true},
+		{"stopped", nil, errors.New("source is gone"), "source is gone", true},
+	}
+	for _, tt := range tests {
+		n, failed := sweepNotification(profile, tt.plan, tt.err)
+		if n == nil || n.Content != tt.content || failed != tt.failed {
+			t.Errorf("%s: sweepNotification = %v, %v, want %q, %v", tt.name, n, failed, tt.content, tt.failed)
+		}
+	}
+	if n, _ := sweepNotification(profile, sweepPlan{{Source: "/d/.x", Action: actionSkip}}, nil); n != nil {
+		t.Errorf("sweep with nothing done = %v, want no notification", n)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"github.com/adrg/xdg"
+)
+
+const preferencesFileName string = "preferences.json"
+
+// filePreferences reads and writes the preferences file of the tray app
+// directly, so the command line shares its settings without starting Fyne.
+// Every change is written straight back to the file, on top of whatever other
+// processes have written there in the meantime. Preferences without a
+// file, such as the team baseline, are only kept in memory. Settings missing
+// from the file are read from base when there is one.
+type filePreferences struct {
+	file      string
+	lock      sync.RWMutex
+	values    map[string]any
+	listeners []func()
+	base      *filePreferences
+}
+
+var _ fyne.Preferences = (*filePreferences)(nil)
+
+// getPreferencesFile returns where Fyne keeps the preferences of the app on osName.
+func getPreferencesFile(osName string) string {
+	var root string
+
+	switch osName {
+	case "darwin":
+		root = path.Join(xdg.Home, "Library", "Preferences")
+	case "windows":
+		root = path.Join(xdg.Home, "AppData", "Roaming")
+	default:
+		root, _ = os.UserConfigDir()
+	}
+
+	return path.Join(root, "fyne", appNamespace, preferencesFileName)
+}
+
+func openPreferences(file string) (*filePreferences, error) {
+	p := &filePreferences{file: file, values: map[string]any{}}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &p.values); err != nil {
+		return nil, err
+	}
+	if p.values == nil {
+		p.values = map[string]any{}
+	}
+	return p, nil
+}
+
+// save re-reads the preferences file, puts the values of keys in it and
+// writes it to a temporary file that is renamed over it, so the tray app never
+// reads a half written file. Settings other processes changed since the file
+// was opened are kept and read back into memory.
+func (p *filePreferences) save(keys ...string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	values := map[string]any{}
+	data, err := os.ReadFile(p.file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &values); err != nil {
+			slog.Warn("Preferences file is damaged, replacing it.", slog.Any("error", err), slog.String("file", p.file))
+			values = maps.Clone(p.values)
+		}
+		if values == nil {
+			values = map[string]any{}
+		}
+	}
+	for _, key := range keys {
+		if v, ok := p.values[key]; ok {
+			values[key] = v
+		} else {
+			delete(values, key)
+		}
+	}
+
+	data, err = json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(p.file), 0700); err != nil {
+		return err
+	}
+	tmp := p.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, p.file); err != nil {
+		return err
+	}
+	p.values = values
+	return nil
+}
+
+func (p *filePreferences) set(key string, value any) {
+	p.lock.Lock()
+	p.values[key] = value
+	p.lock.Unlock()
+	p.changed(key)
+}
+
+func (p *filePreferences) changed(key string) {
+	if p.file == "" {
+		return
+	}
+	if err := p.save(key); err != nil {
+		slog.Error("Unable to save preferences.", slog.Any("error", err), slog.String("file", p.file))
+	}
+	for _, l := range p.ChangeListeners() {
+		l()
+	}
+}
+
+func (p *filePreferences) get(key string) (any, bool) {
+	p.lock.RLock()
+	v, ok := p.values[key]
+	p.lock.RUnlock()
+	if !ok && p.base != nil {
+		return p.base.get(key)
+	}
+	return v, ok
+}
+
+// fromBaseline reports whether the value of key is the one from base.
+func (p *filePreferences) fromBaseline(key string) bool {
+	p.lock.RLock()
+	_, ok := p.values[key]
+	p.lock.RUnlock()
+	return !ok && p.base != nil && p.base.has(key)
+}
+
+func (p *filePreferences) has(key string) bool {
+	_, ok := p.get(key)
+	return ok
+}
+
+// keys returns the names of every stored preference in order, those only
+// set by base included.
+func (p *filePreferences) keys() []string {
+	p.lock.RLock()
+	keys := make([]string, 0, len(p.values))
+	for k := range p.values {
+		keys = append(keys, k)
+	}
+	p.lock.RUnlock()
+	if p.base != nil {
+		for _, k := range p.base.keys() {
+			if !slices.Contains(keys, k) {
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lookup returns the value stored under key as a T. Numbers read back from
+// JSON are float64 and lists are []any, so both are converted.
+func lookup[T any](p *filePreferences, key string, fallback T) T {
+	v, ok := p.get(key)
+	if !ok {
+		return fallback
+	}
+	if t, ok := convert[T](v); ok {
+		return t
+	}
+	return fallback
+}
+
+func lookupList[T any](p *filePreferences, key string, fallback []T) []T {
+	v, ok := p.get(key)
+	if !ok {
+		return fallback
+	}
+	if t, ok := v.([]T); ok {
+		return t
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return fallback
+	}
+	list := make([]T, 0, len(items))
+	for _, item := range items {
+		t, ok := convert[T](item)
+		if !ok {
+			return fallback
+		}
+		list = append(list, t)
+	}
+	return list
+}
+
+func convert[T any](v any) (T, bool) {
+	var t T
+	switch n := v.(type) {
+	case float64:
+		if _, ok := any(t).(int); ok {
+			return any(int(n)).(T), true
+		}
+	case int:
+		if _, ok := any(t).(float64); ok {
+			return any(float64(n)).(T), true
+		}
+	}
+	t, ok := v.(T)
+	return t, ok
+}
+
+func (p *filePreferences) AddChangeListener(listener func()) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.listeners = append(p.listeners, listener)
+}
+
+func (p *filePreferences) ChangeListeners() []func() {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return append([]func(){}, p.listeners...)
+}
+
+func (p *filePreferences) Bool(key string) bool {
+	return p.BoolWithFallback(key, false)
+}
+
+func (p *filePreferences) BoolWithFallback(key string, fallback bool) bool {
+	return lookup(p, key, fallback)
+}
+
+func (p *filePreferences) SetBool(key string, value bool) {
+	p.set(key, value)
+}
+
+func (p *filePreferences) BoolList(key string) []bool {
+	return p.BoolListWithFallback(key, []bool{})
+}
+
+func (p *filePreferences) BoolListWithFallback(key string, fallback []bool) []bool {
+	return lookupList(p, key, fallback)
+}
+
+func (p *filePreferences) SetBoolList(key string, value []bool) {
+	p.set(key, value)
+}
+
+func (p *filePreferences) Float(key string) float64 {
+	return p.FloatWithFallback(key, 0)
+}
+
+func (p *filePreferences) FloatWithFallback(key string, fallback float64) float64 {
+	return lookup(p, key, fallback)
+}
+
+func (p *filePreferences) SetFloat(key string, value float64) {
+	p.set(key, value)
+}
+
+func (p *filePreferences) FloatList(key string) []float64 {
+	return p.FloatListWithFallback(key, []float64{})
+}
+
+func (p *filePreferences) FloatListWithFallback(key string, fallback []float64) []float64 {
+	return lookupList(p, key, fallback)
+}
+
+func (p *filePreferences) SetFloatList(key string, value []float64) {
+	p.set(key, value)
+}
+
+func (p *filePreferences) Int(key string) int {
+	return p.IntWithFallback(key, 0)
+}
+
+func (p *filePreferences) IntWithFallback(key string, fallback int) int {
+	return lookup(p, key, fallback)
+}
+
+func (p *filePreferences) SetInt(key string, value int) {
+	p.set(key, value)
+}
+
+func (p *filePreferences) IntList(key string) []int {
+	return p.IntListWithFallback(key, []int{})
+}
+
+func (p *filePreferences) IntListWithFallback(key string, fallback []int) []int {
+	return lookupList(p, key, fallback)
+}
+
+func (p *filePreferences) SetIntList(key string, value []int) {
+	p.set(key, value)
+}
+
+func (p *filePreferences) String(key string) string {
+	return p.StringWithFallback(key, "")
+}
+
+func (p *filePreferences) StringWithFallback(key, fallback string) string {
+	return lookup(p, key, fallback)
+}
+
+func (p *filePreferences) SetString(key string, value string) {
+	p.set(key, value)
+}
+
+func (p *filePreferences) StringList(key string) []string {
+	return p.StringListWithFallback(key, []string{})
+}
+
+func (p *filePreferences) StringListWithFallback(key string, fallback []string) []string {
+	return lookupList(p, key, fallback)
+}
+
+func (p *filePreferences) SetStringList(key string, value []string) {
+	p.set(key, value)
+}
+
+func (p *filePreferences) RemoveValue(key string) {
+	p.lock.Lock()
+	delete(p.values, key)
+	p.lock.Unlock()
+	p.changed(key)
+}
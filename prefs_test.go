@@ -0,0 +1,46 @@
+package main
+
+import (
+	"path"
+	"testing"
+)
+
+func TestFilePreferencesKeepOtherWriters(t *testing.T) {
+	file := path.Join(t.TempDir(), "preferences.json")
+	daemon, err := openPreferences(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daemon.SetString("AppFolder", "DeskClean")
+
+	cli, err := openPreferences(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.SetInt("RetentionKeepDays", 90)
+	cli.SetString("NotifyPolicy", "always")
+
+	// The daemon's snapshot predates the command line's changes
+	daemon.SetBool("AutoLaunchApp", true)
+	daemon.RemoveValue("NotifyPolicy")
+
+	got, err := openPreferences(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := got.Int("RetentionKeepDays"); v != 90 {
+		t.Errorf("RetentionKeepDays = %d, want 90 from the other writer", v)
+	}
+	if v := got.String("AppFolder"); v != "DeskClean" {
+		t.Errorf("AppFolder = %q, want DeskClean", v)
+	}
+	if !got.Bool("AutoLaunchApp") {
+		t.Error("AutoLaunchApp should be set")
+	}
+	if got.has("NotifyPolicy") {
+		t.Error("NotifyPolicy should be removed")
+	}
+	if v := daemon.Int("RetentionKeepDays"); v != 90 {
+		t.Errorf("daemon reads RetentionKeepDays = %d after saving, want 90", v)
+	}
+}
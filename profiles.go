@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"github.com/adrg/xdg"
+)
+
+// sweepProfile is a source folder swept into its own archive label, date
+// scheme and schedule. Everything else, such as the archive root, rules and
+// exclusions, is shared by all profiles.
+type sweepProfile struct {
+	Name            string `json:"name"`
+	SourcePath      string `json:"sourcePath"`
+	Label           string `json:"label"`
+	DateScheme      string `json:"dateScheme"`
+	FolderTemplate  string `json:"folderTemplate,omitempty"`
+	DateBasis       string `json:"dateBasis,omitempty"`
+	Schedule        string `json:"schedule"`
+	RunInterval     string `json:"runInterval,omitempty"`
+	MinimumAge      int    `json:"minimumAge"`
+	MinimumAgeUnit  string `json:"minimumAgeUnit"`
+	MinimumAgeBasis string `json:"minimumAgeBasis"`
+}
+
+func defaultProfile() sweepProfile {
+	return sweepProfile{
+		Name:            "Desktop",
+		SourcePath:      xdg.UserDirs.Desktop,
+		Label:           "Archive",
+		DateScheme:      "2006-01-02",
+		Schedule:        "0 * * * *",
+		MinimumAgeUnit:  "minutes",
+		MinimumAgeBasis: string(ageBasisModified),
+	}
+}
+
+// loadProfiles returns the configured profiles, or the default profile when
+// there are none. Profiles of older versions are upgraded by migratePreferences.
+func loadProfiles(pref fyne.Preferences) []sweepProfile {
+	data := pref.String("Profiles")
+	if data == "" {
+		return []sweepProfile{defaultProfile()}
+	}
+	profiles := []sweepProfile{}
+	if err := json.Unmarshal([]byte(data), &profiles); err != nil {
+		slog.Error("Unable to read sweep profiles.", slog.Any("error", err))
+	}
+	return profiles
+}
+
+func saveProfiles(pref fyne.Preferences, profiles []sweepProfile) {
+	data, err := json.Marshal(profiles)
+	if err != nil {
+		slog.Error("Unable to save sweep profiles.", slog.Any("error", err))
+		return
+	}
+	pref.SetString("Profiles", string(data))
+}
+
+func findProfile(profiles []sweepProfile, name string) (sweepProfile, bool) {
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return sweepProfile{}, false
+}
+
+// checkProfileName reports why the profile at index i cannot be called name.
+// Profiles are picked by name, so names must be set and differ.
+func checkProfileName(profiles []sweepProfile, i int, name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("profile name is empty")
+	}
+	for j, p := range profiles {
+		if j != i && p.Name == name {
+			return fmt.Errorf("there is already a profile named %s", name)
+		}
+	}
+	return nil
+}
+
+// checkMinimumAge reports why s is not a minimum age.
+func checkMinimumAge(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.New("minimum age must be a whole number")
+	}
+	if n < 0 {
+		return errors.New("minimum age may not be negative")
+	}
+	return nil
+}
+
+// freeProfileName returns "Profile n" for the first n no profile is called.
+func freeProfileName(profiles []sweepProfile) string {
+	for n := len(profiles) + 1; ; n++ {
+		name := fmt.Sprintf("Profile %d", n)
+		if _, taken := findProfile(profiles, name); !taken {
+			return name
+		}
+	}
+}
+
+// migrateRunInterval replaces a run interval from older versions with the
+// equivalent cron spec and reports whether it did.
+func (p *sweepProfile) migrateRunInterval() bool {
+	if p.RunInterval == "" {
+		return false
+	}
+	p.Schedule = intervalToCron(p.RunInterval)
+	slog.Info("Converted run interval to schedule.", slog.String("profile", p.Name), slog.String("runInterval", p.RunInterval), slog.String("schedule", p.Schedule))
+	p.RunInterval = ""
+	return true
+}
+
+// minimumAge returns how old an item must be before the profile sweeps it.
+func (p sweepProfile) minimumAge() time.Duration {
+	unit := time.Minute
+	switch p.MinimumAgeUnit {
+	case "hours":
+		unit = time.Hour
+	case "days":
+		unit = 24 * time.Hour
+	}
+	return time.Duration(p.MinimumAge) * unit
+}
+
+// scheduleProfiles runs every profile on its cron schedule, or watches it when
+// it runs on change, and calls sweep whenever one fires. Sweeps triggered by a
+// watcher are limited to the entries that changed, scheduled sweeps pass nil to
+// sweep everything. Closing the returned channel stops them all.
+func scheduleProfiles(profiles []sweepProfile, sweep func(sweepProfile, []string, sweepTrigger)) chan bool {
+	stop := make(chan bool)
+	for _, p := range profiles {
+		switch p.Schedule {
+		case scheduleOnDemand, "":
+			slog.Info("Sweeper set to run on demand.", slog.String("profile", p.Name))
+		case runOnChange:
+			err := watchProfile(p, stop, sweep)
+			if err == nil {
+				continue
+			}
+			if isWatchLimit(err) {
+				slog.Warn("Out of file watches, sweeping on a timer instead.", slog.Any("error", err), slog.String("profile", p.Name))
+			} else {
+				slog.Error("Unable to watch sweep location, sweeping on a timer instead.", slog.Any("error", err), slog.String("profile", p.Name))
+			}
+			go runTicker(p, watchFallbackInterval, stop, sweep)
+		default:
+			c, err := parseCron(p.Schedule)
+			if err != nil {
+				slog.Error("Invalid schedule, sweeping on demand only.", slog.Any("error", err), slog.String("profile", p.Name), slog.String("schedule", p.Schedule))
+				continue
+			}
+			go runCron(p, c, stop, sweep)
+		}
+	}
+	return stop
+}
+
+// runCron sweeps the profile each time the schedule fires until stopped.
+func runCron(p sweepProfile, c cronSchedule, stop chan bool, sweep func(sweepProfile, []string, sweepTrigger)) {
+	for {
+		next, err := c.next(time.Now())
+		if err != nil {
+			slog.Error("Schedule never fires.", slog.Any("error", err), slog.String("profile", p.Name), slog.String("schedule", p.Schedule))
+			return
+		}
+		slog.Info("Set sweep timer event.", slog.String("profile", p.Name), slog.String("schedule", p.Schedule), slog.Time("next", next))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			sweep(p, nil, triggerSchedule)
+		}
+	}
+}
+
+// runTicker sweeps the profile at a fixed interval until stopped.
+func runTicker(p sweepProfile, interval time.Duration, stop chan bool, sweep func(sweepProfile, []string, sweepTrigger)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	slog.Info("Set sweep timer event.", slog.String("profile", p.Name), slog.Duration("interval", interval))
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			sweep(p, nil, triggerSchedule)
+		}
+	}
+}
+
+// dateBasis returns which date names the archive folders, the sweep time
+// unless the profile says otherwise.
+func (p sweepProfile) dateBasis() dateBasis {
+	if p.DateBasis == "" {
+		return dateBasisSweep
+	}
+	return dateBasis(p.DateBasis)
+}
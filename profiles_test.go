@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestCheckProfileName(t *testing.T) {
+	profiles := []sweepProfile{{Name: "Desktop"}, {Name: "Downloads"}}
+	tests := []struct {
+		i    int
+		name string
+		ok   bool
+	}{
+		{0, "Desktop", true},
+		{0, "Screenshots", true},
+		{0, "Downloads", false},
+		{1, "Desktop", false},
+		{-1, "Desktop", false},
+		{0, "", false},
+		{0, "  ", false},
+	}
+	for _, tt := range tests {
+		if err := checkProfileName(profiles, tt.i, tt.name); (err == nil) != tt.ok {
+			t.Errorf("checkProfileName(%d, %q) = %v, want ok %v", tt.i, tt.name, err, tt.ok)
+		}
+	}
+
+	if got := freeProfileName([]sweepProfile{{Name: "Desktop"}, {Name: "Profile 3"}}); got != "Profile 4" {
+		t.Errorf("freeProfileName = %q, want Profile 4", got)
+	}
+}
+
+func TestCheckMinimumAge(t *testing.T) {
+	for s, ok := range map[string]bool{"0": true, "15": true, "-1": false, "": false, "1.5": false, "soon": false} {
+		if err := checkMinimumAge(s); (err == nil) != ok {
+			t.Errorf("checkMinimumAge(%q) = %v, want ok %v", s, err, ok)
+		}
+	}
+}
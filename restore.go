@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// restoreItem puts a swept item back where it was swept from, extracting it
+// when it has been packed into a bundle. A taken original location is settled
+// with the collision policy. It returns where the item ended up.
+func restoreItem(item catalogItem, policy collisionPolicy, now time.Time) (string, error) {
+	if item.RestoredAt != nil && item.Entry == "" {
+		return "", fmt.Errorf("%s was already restored to %s", item.Archived, item.RestoredTo)
+	}
+	if item.Original == "" {
+		return "", fmt.Errorf("the original location of %s is not known", item.location())
+	}
+	if _, err := os.Lstat(item.Archived); err != nil {
+		return "", err
+	}
+
+	m := plannedMove{Source: item.Archived, Destination: item.Original, Action: actionMove}
+	if exists(m.Destination) {
+		if item.Entry != "" && policy == collisionNewer {
+			// The bundle is younger than anything in it, compare the entry itself
+			dst, err := os.Stat(m.Destination)
+			if err != nil {
+				return "", err
+			}
+			if !item.ModTime.After(dst.ModTime()) {
+				return "", fmt.Errorf("%s is taken by a newer copy", m.Destination)
+			}
+			m.Collision = collisionNewer
+		} else if err := resolveCollision(&m, policy, now, exists); err != nil {
+			return "", err
+		}
+		if m.Action == actionSkip && m.Collision == collisionNewer {
+			return "", fmt.Errorf("%s is taken by a newer copy", item.Original)
+		}
+		if m.Action == actionSkip {
+			return "", fmt.Errorf("%s is taken", item.Original)
+		}
+		if m.Collision == collisionOverwrite || m.Collision == collisionNewer {
+			if err := removeForOverwrite(m.Destination); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if err := os.MkdirAll(path.Dir(m.Destination), os.ModePerm); err != nil {
+		return "", err
+	}
+	if item.Entry != "" {
+		return m.Destination, extractBundleEntry(item.Archived, item.Entry, m.Destination)
+	}
+	return m.Destination, moveFile(item.Archived, m.Destination)
+}
+
+// restoreSwept restores the swept item that ref names, by catalog ID or path,
+// and marks it restored in the catalog and the sweep history.
+func restoreSwept(pref fyne.Preferences, appName, ref string, policy collisionPolicy) (catalogItem, string, error) {
+	unlock, err := lockArchive(appName)
+	if err != nil {
+		return catalogItem{}, "", err
+	}
+	defer unlock()
+
+	c, err := openCatalog(pref, appName)
+	if err != nil {
+		return catalogItem{}, "", err
+	}
+	item, err := c.lookup(ref)
+	if err != nil {
+		return item, "", err
+	}
+	now := time.Now()
+	dst, err := restoreItem(item, policy, now)
+	if err != nil {
+		return item, "", err
+	}
+	slog.Info("Restored swept item.", slog.String("file", item.location()), slog.String("destination", dst))
+
+	c.markRestored(item, dst, now)
+	if err := c.save(); err != nil {
+		slog.Warn("Unable to save catalog.", slog.Any("error", err))
+	}
+	if item.ManifestID != "" {
+		restored := restoredItem{Archived: item.location(), RestoredTo: dst, RestoredAt: now}
+		if err := markManifestRestored(getManifestDir(appName), item.ManifestID, restored); err != nil {
+			slog.Warn("Unable to record restore in sweep history.", slog.Any("error", err), slog.String("manifest", item.ManifestID))
+		}
+	}
+	return item, dst, nil
+}
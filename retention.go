@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+type retentionAction string
+
+const (
+	retentionMerge  retentionAction = "merge"
+	retentionDelete retentionAction = "delete"
+	retentionBundle retentionAction = "bundle"
+
+	manifestKindRetention string = "retention"
+)
+
+// retentionPolicy decides how long dated archive folders are kept. Daily
+// folders older than DailyDays are merged into a folder for their month,
+// folders older than BundleDays are packed into a compressed bundle and
+// folders and bundles older than KeepDays are deleted. Zero turns any off.
+type retentionPolicy struct {
+	DailyDays      int
+	BundleDays     int
+	BundleFormat   bundleFormat
+	KeepDays       int
+	ConfirmDeletes bool
+}
+
+func loadRetentionPolicy(pref fyne.Preferences) retentionPolicy {
+	return retentionPolicy{
+		DailyDays:      pref.Int("RetentionDailyDays"),
+		BundleDays:     pref.Int("BundleAfterDays"),
+		BundleFormat:   bundleFormat(pref.StringWithFallback("BundleFormat", string(bundleZip))),
+		KeepDays:       pref.Int("RetentionKeepDays"),
+		ConfirmDeletes: pref.BoolWithFallback("RetentionConfirmDeletes", true),
+	}
+}
+
+// retentionStep merges, bundles or deletes a single dated archive folder, or
+// deletes a bundle.
+type retentionStep struct {
+	Action      retentionAction `json:"action"`
+	Folder      string          `json:"folder"`
+	Destination string          `json:"destination,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+func (s retentionStep) String() string {
+	if s.Destination != "" {
+		return fmt.Sprintf("%s %s -> %s", s.Action, s.Folder, s.Destination)
+	}
+	return fmt.Sprintf("%s %s", s.Action, s.Folder)
+}
+
+type retentionPlan []retentionStep
+
+func (p retentionPlan) count(action retentionAction) int {
+	n := 0
+	for _, s := range p {
+		if s.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// countFailed returns the number of folders that could not be merged or deleted.
+func (p retentionPlan) countFailed() int {
+	n := 0
+	for _, s := range p {
+		if s.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// write prints the plan as a table, one folder per line.
+func (p retentionPlan) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tFOLDER\tDESTINATION\tERROR")
+	for _, s := range p {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Action, s.Folder, s.Destination, s.Error)
+	}
+	return tw.Flush()
+}
+
+// monthScheme drops the day from a date scheme, "2006-01-02" becomes "2006-01".
+// Schemes without a day are returned unchanged.
+func monthScheme(scheme string) string {
+	if strings.Contains(scheme, "-02") {
+		return strings.Replace(scheme, "-02", "", 1)
+	}
+	return strings.Replace(scheme, "02-", "", 1)
+}
+
+// parseArchiveFolder recognises the dated folders that sweeps of the profiles
+// create, returning the profile, the date and whether it is a daily folder.
+func parseArchiveFolder(name, sep string, profiles []sweepProfile, loc *time.Location) (sweepProfile, time.Time, bool, bool) {
+	for _, p := range profiles {
+		// Folders named by a custom template are not dated the same way
+		if p.FolderTemplate != "" {
+			continue
+		}
+		date, found := strings.CutSuffix(name, sep+p.Label)
+		if !found {
+			continue
+		}
+		if t, err := time.ParseInLocation(p.DateScheme, date, loc); err == nil {
+			return p, t, strings.Contains(p.DateScheme, "02"), true
+		}
+		if t, err := time.ParseInLocation(monthScheme(p.DateScheme), date, loc); err == nil {
+			return p, t, false, true
+		}
+	}
+	return sweepProfile{}, time.Time{}, false, false
+}
+
+// planRetention lists the dated archive folders the policy merges, bundles or
+// deletes, and the bundles it deletes.
+func planRetention(archiveRoot, sep string, profiles []sweepProfile, policy retentionPolicy, now time.Time) (retentionPlan, error) {
+	plan := retentionPlan{}
+	entries, err := os.ReadDir(archiveRoot)
+	if errors.Is(err, os.ErrNotExist) {
+		return plan, nil
+	}
+	if err != nil {
+		return plan, err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		isBundle := false
+		if !e.IsDir() {
+			if _, name, isBundle = bundleFormatOf(name); !isBundle {
+				continue
+			}
+		}
+		p, date, daily, ok := parseArchiveFolder(name, sep, profiles, now.Location())
+		if !ok {
+			continue
+		}
+		// A folder is only as old as the last day it covers
+		end := date.AddDate(0, 1, 0)
+		if daily {
+			end = date.AddDate(0, 0, 1)
+		}
+		// Folders named by the date of their files get old items at every
+		// sweep, so they are only as old as the last change to them
+		if p.dateBasis() != dateBasisSweep {
+			info, err := e.Info()
+			if err != nil {
+				return plan, err
+			}
+			if info.ModTime().After(end) {
+				end = info.ModTime()
+			}
+		}
+		folder := path.Join(archiveRoot, e.Name())
+
+		switch {
+		case policy.KeepDays > 0 && end.Before(now.AddDate(0, 0, -policy.KeepDays)):
+			plan = append(plan, retentionStep{Action: retentionDelete, Folder: folder})
+		case isBundle:
+			// Bundles are never merged or bundled again
+		case daily && policy.DailyDays > 0 && end.Before(now.AddDate(0, 0, -policy.DailyDays)):
+			month := date.Format(monthScheme(p.DateScheme)) + sep + p.Label
+			plan = append(plan, retentionStep{Action: retentionMerge, Folder: folder, Destination: path.Join(archiveRoot, month)})
+		case policy.BundleDays > 0 && end.Before(now.AddDate(0, 0, -policy.BundleDays)):
+			bundle := freeName(folder+"."+string(policy.BundleFormat), exists)
+			plan = append(plan, retentionStep{Action: retentionBundle, Folder: folder, Destination: bundle})
+		}
+	}
+	return plan, nil
+}
+
+// applyRetention carries out the plan and records what it did in a manifest.
+// Deletions are only made when deletes is set, the rest are left pending.
+// The catalog, the hash index and the sweep history follow every merged item
+// to its new place, while bundled and deleted folders leave the hash index.
+func applyRetention(plan retentionPlan, deletes bool, manifestDir, hashFile string, catalog *sweepCatalog, now time.Time) (retentionPlan, error) {
+	m := sweepManifest{
+		ID:      now.UTC().Format(manifestIDStamp),
+		Kind:    manifestKindRetention,
+		SweptAt: now,
+		Moves:   []movedItem{},
+	}
+	done := retentionPlan{}
+	merged, gone := []movedItem{}, []string{}
+	for _, s := range plan {
+		switch s.Action {
+		case retentionMerge:
+			moves, err := mergeFolder(s.Folder, s.Destination)
+			m.Moves = append(m.Moves, moves...)
+			merged = append(merged, moves...)
+			for _, mv := range moves {
+				catalog.relocate(mv.Original, mv.Archived)
+			}
+			if err != nil {
+				s.Error = err.Error()
+				slog.Warn("Failed to merge archive folder.", slog.Any("error", err), slog.String("folder", s.Folder))
+			}
+		case retentionDelete:
+			if !deletes {
+				continue
+			}
+			if err := os.RemoveAll(s.Folder); err != nil {
+				s.Error = err.Error()
+				slog.Warn("Failed to delete archive folder.", slog.Any("error", err), slog.String("folder", s.Folder))
+			} else {
+				m.Deleted = append(m.Deleted, s.Folder)
+				gone = append(gone, s.Folder)
+				os.Remove(s.Folder + bundleIndexExt)
+				catalog.forget(s.Folder)
+			}
+		case retentionBundle:
+			if _, err := bundleFolder(s.Folder, s.Destination); err != nil {
+				s.Error = err.Error()
+				slog.Warn("Failed to bundle archive folder.", slog.Any("error", err), slog.String("folder", s.Folder))
+			} else {
+				m.Moves = append(m.Moves, movedItem{Original: s.Folder, Archived: s.Destination})
+				gone = append(gone, s.Folder)
+				catalog.bundle(s.Folder, s.Destination)
+			}
+		}
+		done = append(done, s)
+	}
+
+	if len(merged) > 0 {
+		if err := relocateHashIndex(hashFile, merged); err != nil {
+			slog.Warn("Unable to update hash index.", slog.Any("error", err))
+		}
+		if err := relocateManifests(manifestDir, merged); err != nil {
+			slog.Warn("Unable to update sweep history.", slog.Any("error", err))
+		}
+	}
+	if len(gone) > 0 {
+		if err := forgetHashes(hashFile, gone); err != nil {
+			slog.Warn("Unable to update hash index.", slog.Any("error", err))
+		}
+	}
+
+	if len(m.Moves)+len(m.Deleted) == 0 {
+		return done, nil
+	}
+	slog.Info("Retention completed.", slog.Int("mergedFolderCount", done.count(retentionMerge)), slog.Int("bundledFolderCount", done.count(retentionBundle)), slog.Int("deletedFolderCount", len(m.Deleted)))
+	return done, saveManifest(manifestDir, m)
+}
+
+// mergeFolder moves every entry of folder into dest, numbering any names that
+// are already taken, and removes folder once it is empty.
+func mergeFolder(folder, dest string) ([]movedItem, error) {
+	moves := []movedItem{}
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return moves, err
+	}
+	if err := os.MkdirAll(dest, os.ModePerm); err != nil {
+		return moves, err
+	}
+	for _, e := range entries {
+		src := path.Join(folder, e.Name())
+		dst := freeName(path.Join(dest, e.Name()), exists)
+		if err := moveFile(src, dst); err != nil {
+			return moves, err
+		}
+		moves = append(moves, movedItem{Original: src, Archived: dst})
+	}
+	return moves, os.Remove(folder)
+}
+
+// runRetention enforces the retention policy on the archive. Deletions wait
+// for confirm unless the policy says not to ask.
+func runRetention(pref fyne.Preferences, appName string, confirm bool) (retentionPlan, error) {
+	unlock, err := lockArchive(appName)
+	if err != nil {
+		return retentionPlan{}, err
+	}
+	defer unlock()
+
+	policy := loadRetentionPolicy(pref)
+	if policy.DailyDays == 0 && policy.BundleDays == 0 && policy.KeepDays == 0 {
+		return retentionPlan{}, nil
+	}
+	now := time.Now()
+	plan, err := previewRetention(pref, now)
+	if err != nil {
+		return plan, err
+	}
+	deletes := confirm || !policy.ConfirmDeletes
+	if pending := plan.count(retentionDelete); pending > 0 && !deletes {
+		slog.Info("Archive folders are waiting to be deleted.", slog.Int("folderCount", pending))
+	}
+	var done retentionPlan
+	updateCatalog(pref, appName, func(c *sweepCatalog) {
+		done, err = applyRetention(plan, deletes, getManifestDir(appName), path.Join(getDataDir(appName), hashIndexFile), c, now)
+	})
+	return done, err
+}
+
+// previewRetention plans the retention pass without touching the archive.
+func previewRetention(pref fyne.Preferences, now time.Time) (retentionPlan, error) {
+	archiveRoot := getArchiveRoot(pref)
+	return planRetention(archiveRoot, pref.String("TargetFolderSeparator"), loadProfiles(pref), loadRetentionPolicy(pref), now)
+}
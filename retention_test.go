@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestRetentionAfterSweepByFileDate(t *testing.T) {
+	dir := t.TempDir()
+	pref, err := openPreferences(path.Join(dir, "preferences.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setArchiveRoot(pref, path.Join(dir, "Archive"))
+	pref.SetString("TargetFolderSeparator", "-")
+	profile := sweepProfile{Name: "Desktop", SourcePath: path.Join(dir, "Desktop"), Label: "Archive", DateScheme: "2006-01-02", DateBasis: string(dateBasisModified)}
+	saveProfiles(pref, []sweepProfile{profile})
+
+	writeTree(t, profile.SourcePath, map[string]string{"old.txt": "from 2020"})
+	modified := time.Date(2020, time.June, 1, 12, 0, 0, 0, time.Local)
+	if err := os.Chtimes(path.Join(profile.SourcePath, "old.txt"), time.Time{}, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	plan, err := sweepFiles(os.DirFS(profile.SourcePath), profile.SourcePath, getTargetPath(pref, profile, now), getSweepOptions(pref, profile, false, now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := path.Join(getArchiveRoot(pref), "2020-06-01-Archive", "old.txt")
+	if len(plan) != 1 || plan[0].Destination != want || plan[0].Error != "" {
+		t.Fatalf("sweep plan = %v, want old.txt moved to %s", plan, want)
+	}
+
+	// The folder is named after 2020 but was only just filled
+	policy := retentionPolicy{DailyDays: 1, BundleDays: 7, BundleFormat: bundleZip, KeepDays: 30}
+	retention, err := planRetention(getArchiveRoot(pref), "-", loadProfiles(pref), policy, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retention) != 0 {
+		t.Errorf("retention right after the sweep = %v, want nothing", retention)
+	}
+
+	retention, err = planRetention(getArchiveRoot(pref), "-", loadProfiles(pref), policy, now.AddDate(0, 0, 31))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retention) != 1 || retention[0].Action != retentionDelete {
+		t.Errorf("retention a month later = %v, want the folder deleted", retention)
+	}
+}
+
+func TestPlanRetention(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"2026-10-15-Archive/new.txt":      "new",
+		"2026-08-01-Archive/a.txt":        "a",
+		"2026-06-Archive/b.txt":           "b",
+		"2025-01-05-Archive/c.txt":        "c",
+		"2025-01-Archive.zip":             "zip",
+		"2025-03-Archive (1).tar.gz":      "tar",
+		"2026-01-01-Shots/shot.png":       "png",
+		"Unrelated/d.txt":                 "d",
+		"2026-08-02-Archive.notes.txt":    "not a bundle",
+		"2026-08-03-Archive/project/e.md": "e",
+	})
+	profiles := []sweepProfile{
+		{Name: "Desktop", Label: "Archive", DateScheme: "2006-01-02"},
+		{Name: "Screenshots", Label: "Shots", DateScheme: "2006-01-02", FolderTemplate: "{date}-Shots"},
+	}
+	policy := retentionPolicy{DailyDays: 30, BundleDays: 60, BundleFormat: bundleZip, KeepDays: 365}
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.Local)
+
+	plan, err := planRetention(root, "-", profiles, policy, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]retentionStep{
+		"2025-01-05-Archive":         {Action: retentionDelete},
+		"2025-01-Archive.zip":        {Action: retentionDelete},
+		"2025-03-Archive (1).tar.gz": {Action: retentionDelete},
+		"2026-06-Archive":            {Action: retentionBundle, Destination: path.Join(root, "2026-06-Archive.zip")},
+		"2026-08-01-Archive":         {Action: retentionMerge, Destination: path.Join(root, "2026-08-Archive")},
+		"2026-08-03-Archive":         {Action: retentionMerge, Destination: path.Join(root, "2026-08-Archive")},
+	}
+	if len(plan) != len(want) {
+		t.Errorf("planned %d steps, want %d: %v", len(plan), len(want), plan)
+	}
+	for _, s := range plan {
+		w, ok := want[path.Base(s.Folder)]
+		if !ok || s.Action != w.Action || s.Destination != w.Destination {
+			t.Errorf("step %v, want %v", s, w)
+		}
+	}
+
+	if plan, err := planRetention(path.Join(root, "missing"), "-", profiles, policy, now); err != nil || len(plan) != 0 {
+		t.Errorf("plan of a missing archive = %v, %v, want nothing", plan, err)
+	}
+	if plan, err := planRetention(root, "-", profiles, retentionPolicy{}, now); err != nil || len(plan) != 0 {
+		t.Errorf("plan with every step off = %v, %v, want nothing", plan, err)
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	dir := t.TempDir()
+	root, manifests, hashFile := path.Join(dir, "Archive"), path.Join(dir, "manifests"), path.Join(dir, "hashes.json")
+	writeTree(t, root, map[string]string{
+		"2026-08-01-Archive/a.txt": "a",
+		"2026-08-Archive/a.txt":    "merged earlier",
+		"2026-06-Archive/b.txt":    "b",
+		"2025-01-05-Archive/c.txt": "c",
+	})
+	catalog := &sweepCatalog{Items: []catalogItem{
+		{Archived: path.Join(root, "2026-08-01-Archive/a.txt")},
+		{Archived: path.Join(root, "2026-06-Archive/b.txt")},
+		{Archived: path.Join(root, "2025-01-05-Archive/c.txt")},
+	}}
+	catalog.reindex()
+	plan := retentionPlan{
+		{Action: retentionMerge, Folder: path.Join(root, "2026-08-01-Archive"), Destination: path.Join(root, "2026-08-Archive")},
+		{Action: retentionBundle, Folder: path.Join(root, "2026-06-Archive"), Destination: path.Join(root, "2026-06-Archive.zip")},
+		{Action: retentionDelete, Folder: path.Join(root, "2025-01-05-Archive")},
+	}
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+
+	// Deletions wait for confirmation
+	done, err := applyRetention(plan, false, manifests, hashFile, catalog, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 || done.countFailed() != 0 {
+		t.Fatalf("applied %v, want the merge and the bundle", done)
+	}
+	merged := path.Join(root, "2026-08-Archive/a (1).txt")
+	if data, err := os.ReadFile(merged); err != nil || string(data) != "a" {
+		t.Errorf("merged a.txt = %q, %v, want it numbered next to the earlier one", data, err)
+	}
+	if _, err := os.Lstat(path.Join(root, "2026-08-01-Archive")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("merged folder still exists: %v", err)
+	}
+	if _, err := os.Lstat(path.Join(root, "2025-01-05-Archive/c.txt")); err != nil {
+		t.Errorf("unconfirmed delete went ahead: %v", err)
+	}
+	if catalog.Items[0].Archived != merged {
+		t.Errorf("catalog has a.txt at %s, want %s", catalog.Items[0].Archived, merged)
+	}
+	if item := catalog.Items[1]; item.Archived != path.Join(root, "2026-06-Archive.zip") || item.Entry != "b.txt" {
+		t.Errorf("catalog has b.txt at %s entry %q, want it in the bundle", item.Archived, item.Entry)
+	}
+	history, err := listManifests(manifests)
+	if err != nil || len(history) != 1 || history[0].Kind != manifestKindRetention || len(history[0].Moves) != 2 {
+		t.Fatalf("history = %+v, %v, want a retention manifest with two moves", history, err)
+	}
+
+	done, err = applyRetention(plan[2:], true, manifests, hashFile, catalog, now.Add(time.Minute))
+	if err != nil || len(done) != 1 || done[0].Error != "" {
+		t.Fatalf("confirmed delete = %v, %v", done, err)
+	}
+	if _, err := os.Lstat(path.Join(root, "2025-01-05-Archive")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("deleted folder still exists: %v", err)
+	}
+}
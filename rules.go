@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// sweepRule sends matching entries somewhere other than the dated archive folder.
+// Rules are written one per line as
+//
+//	<pattern>[|<pattern>...] [condition...] -> <folder>|delete [after <age>]|skip
+//
+// where a pattern is a glob or an extension such as ".pdf" matched against the
+// entry name, and a condition is one of mime:<type>, size>N, size<N, age>D or
+// age<D. Folders are relative to the archive root and may contain {date}.
+// Entries a delete or trash rule matches before they are After old wait for
+// it instead of being swept.
+type sweepRule struct {
+	Text        string
+	Patterns    []string
+	MIME        string
+	MinSize     int64
+	MaxSize     int64
+	MinAge      time.Duration
+	MaxAge      time.Duration
+	After       time.Duration
+	Action      sweepAction
+	Destination string
+}
+
+// ruleSubject is the entry a rule is checked against. The MIME type is only
+// sniffed when a rule asks for it since it means reading the file.
+type ruleSubject struct {
+	name string
+	info fs.FileInfo
+	mime func() string
+}
+
+var sizeUnits = map[string]int64{"": 1, "b": 1, "k": 1 << 10, "kb": 1 << 10, "m": 1 << 20, "mb": 1 << 20, "g": 1 << 30, "gb": 1 << 30}
+
+var ageUnits = map[string]time.Duration{
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
+// loadRules parses the rules stored in preferences, skipping any that are invalid.
+func loadRules(pref fyne.Preferences) []sweepRule {
+	rules := []sweepRule{}
+	for _, text := range pref.StringList("Rules") {
+		r, err := parseRule(text)
+		if err != nil {
+			slog.Warn("Ignoring invalid rule.", slog.Any("error", err), slog.String("rule", text))
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+func parseRule(text string) (sweepRule, error) {
+	r := sweepRule{Text: strings.TrimSpace(text), MinSize: -1, MaxSize: -1}
+
+	lhs, rhs, ok := strings.Cut(strings.ReplaceAll(r.Text, "→", "->"), "->")
+	if !ok {
+		return r, errors.New(`rule needs "->" between the match and the action`)
+	}
+
+	fields := strings.Fields(lhs)
+	if len(fields) == 0 {
+		return r, errors.New("rule has no pattern")
+	}
+	for _, p := range strings.Split(fields[0], "|") {
+		if p == "" {
+			return r, errors.New("rule has an empty pattern")
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return r, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		r.Patterns = append(r.Patterns, strings.ToLower(p))
+	}
+	for _, c := range fields[1:] {
+		if err := r.parseCondition(c); err != nil {
+			return r, err
+		}
+	}
+
+	action := strings.Fields(rhs)
+	if len(action) == 0 {
+		return r, errors.New("rule has no action")
+	}
+	switch strings.ToLower(action[0]) {
+	case "skip":
+		r.Action = actionSkip
+	case "delete", "trash":
+		r.Action = sweepAction(strings.ToLower(action[0]))
+		if len(action) > 1 {
+			if strings.ToLower(action[1]) != "after" || len(action) == 2 {
+				return r, fmt.Errorf(`expected "%s after <age>"`, r.Action)
+			}
+			age, err := parseAge(strings.Join(action[2:], ""))
+			if err != nil {
+				return r, err
+			}
+			r.After = age
+		}
+	default:
+		r.Action = actionMove
+		r.Destination = strings.TrimSpace(rhs)
+	}
+	return r, nil
+}
+
+func (r *sweepRule) parseCondition(c string) error {
+	key, value, ok := strings.Cut(c, ":")
+	if ok && strings.ToLower(key) == "mime" {
+		if _, err := path.Match(value, ""); err != nil || value == "" {
+			return fmt.Errorf("invalid MIME type %q", value)
+		}
+		r.MIME = strings.ToLower(value)
+		return nil
+	}
+
+	for _, op := range []string{">", "<"} {
+		key, value, ok := strings.Cut(c, op)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "size":
+			size, err := parseSize(value)
+			if err != nil {
+				return err
+			}
+			if op == ">" {
+				r.MinSize = size
+			} else {
+				r.MaxSize = size
+			}
+			return nil
+		case "age":
+			age, err := parseAge(value)
+			if err != nil {
+				return err
+			}
+			if op == ">" {
+				r.MinAge = age
+			} else {
+				r.MaxAge = age
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown condition %q", c)
+}
+
+// splitQuantity splits text such as "10MB" into its number and unit.
+func splitQuantity(text string) (int64, string, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	i := strings.IndexFunc(text, func(r rune) bool { return r < '0' || r > '9' })
+	if i == -1 {
+		i = len(text)
+	}
+	n, err := strconv.ParseInt(text[:i], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid number in %q", text)
+	}
+	return n, strings.TrimSpace(text[i:]), nil
+}
+
+func parseSize(text string) (int64, error) {
+	n, unit, err := splitQuantity(text)
+	if err != nil {
+		return 0, err
+	}
+	mult, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit %q", unit)
+	}
+	return n * mult, nil
+}
+
+func parseAge(text string) (time.Duration, error) {
+	n, unit, err := splitQuantity(text)
+	if err != nil {
+		return 0, err
+	}
+	mult, ok := ageUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown age unit %q", unit)
+	}
+	return time.Duration(n) * mult, nil
+}
+
+// matches reports whether the subject meets every pattern and condition of the rule.
+func (r sweepRule) matches(s ruleSubject, now time.Time) bool {
+	if !r.matchesName(s.name) {
+		return false
+	}
+	size := s.info.Size()
+	if s.info.IsDir() {
+		size = 0
+	}
+	if r.MinSize > -1 && size <= r.MinSize {
+		return false
+	}
+	if r.MaxSize > -1 && size >= r.MaxSize {
+		return false
+	}
+	age := now.Sub(s.info.ModTime())
+	if r.MinAge > 0 && age <= r.MinAge {
+		return false
+	}
+	if r.MaxAge > 0 && age >= r.MaxAge {
+		return false
+	}
+	if r.MIME != "" {
+		if ok, _ := path.Match(r.MIME, s.mime()); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// waiting reports whether the entry is not yet old enough for the rule to
+// delete or trash it.
+func (r sweepRule) waiting(info fs.FileInfo, now time.Time) bool {
+	return r.After > 0 && now.Sub(info.ModTime()) <= r.After
+}
+
+func (r sweepRule) matchesName(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range r.Patterns {
+		if strings.HasPrefix(p, ".") && !strings.ContainsAny(p, `*?[\`) {
+			if path.Ext(name) == p {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// destinationFor expands the rule destination for a sweep run at now.
+func (r sweepRule) destinationFor(archiveRoot, dateScheme string, now time.Time) string {
+	dest := strings.ReplaceAll(r.Destination, "{date}", now.Format(dateScheme))
+	if path.IsAbs(dest) {
+		return path.Clean(dest)
+	}
+	return path.Join(archiveRoot, dest)
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// sweepAction is what a sweep does with a single source entry.
+type sweepAction string
+
+const (
+	actionMove   sweepAction = "move"
+	actionSkip   sweepAction = "skip"
+	actionDelete sweepAction = "delete"
+	actionTrash  sweepAction = "trash"
+
+	skipReasonTooNew     string = "younger than minimum age"
+	skipReasonIgnored    string = "ignored"
+	skipReasonWaitDelete string = "waiting to be deleted"
+	skipReasonWaitTrash  string = "waiting to be trashed"
+)
+
+// ageBasis selects which file timestamp the minimum age is measured from.
+type ageBasis string
+
+const (
+	ageBasisModified ageBasis = "modified"
+	ageBasisChanged  ageBasis = "changed"
+)
+
+var (
+	allowedAgeBases = []string{string(ageBasisModified), string(ageBasisChanged)}
+	allowedAgeUnits = []string{"minutes", "hours", "days"}
+)
+
+// plannedMove describes what a sweep will do with a single source entry.
+type plannedMove struct {
+	Source      string          `json:"source"`
+	Destination string          `json:"destination,omitempty"`
+	Action      sweepAction     `json:"action"`
+	SkipReason  string          `json:"skipReason,omitempty"`
+	Rule        string          `json:"rule,omitempty"`
+	Collision   collisionPolicy `json:"collision,omitempty"`
+	IgnoredBy   string          `json:"ignoredBy,omitempty"`
+	Hash        string          `json:"hash,omitempty"`
+	Size        int64           `json:"size,omitempty"`
+	DuplicateOf string          `json:"duplicateOf,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	SourceKept  bool            `json:"sourceKept,omitempty"`
+}
+
+func (m plannedMove) String() string {
+	switch {
+	case m.IgnoredBy != "":
+		return fmt.Sprintf("%s %s (ignored by %s)", m.Action, m.Source, m.IgnoredBy)
+	case m.Action == actionSkip && m.Rule != "" && m.SkipReason != "rule":
+		return fmt.Sprintf("%s %s (%s, rule %s)", m.Action, m.Source, m.SkipReason, m.Rule)
+	case m.Action == actionSkip && m.Rule != "":
+		return fmt.Sprintf("%s %s (rule %s)", m.Action, m.Source, m.Rule)
+	case m.Action == actionSkip:
+		return fmt.Sprintf("%s %s (%s)", m.Action, m.Source, m.SkipReason)
+	case m.Action == actionDelete, m.Action == actionTrash && m.Destination == "":
+		return fmt.Sprintf("%s %s (rule %s)", m.Action, m.Source, m.Rule)
+	case m.DuplicateOf != "":
+		return fmt.Sprintf("%s %s → %s (duplicate of %s)", m.Action, m.Source, m.Destination, m.DuplicateOf)
+	case m.Collision != "":
+		return fmt.Sprintf("%s %s → %s (name exists, %s)", m.Action, m.Source, m.Destination, m.Collision)
+	}
+	return fmt.Sprintf("%s %s → %s", m.Action, m.Source, m.Destination)
+}
+
+// sweepPlan is the ordered list of entries a sweep will act on.
+type sweepPlan []plannedMove
+
+// count returns the number of planned entries with the given action.
+func (p sweepPlan) count(action sweepAction) int {
+	n := 0
+	for _, m := range p {
+		if m.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// countSkipped returns the number of skipped entries with the given reason.
+func (p sweepPlan) countSkipped(reason string) int {
+	n := 0
+	for _, m := range p {
+		if m.Action == actionSkip && m.SkipReason == reason {
+			n++
+		}
+	}
+	return n
+}
+
+// countFailed returns the number of entries that could not be moved or deleted.
+func (p sweepPlan) countFailed() int {
+	n := 0
+	for _, m := range p {
+		if m.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// write prints the plan as a table, one entry per line.
+func (p sweepPlan) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tSOURCE\tDESTINATION\tREASON\tRULE\tCOLLISION\tPATTERN\tDUPLICATE OF")
+	for _, m := range p {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", m.Action, m.Source, m.Destination, m.SkipReason, m.Rule, m.Collision, m.IgnoredBy, m.DuplicateOf)
+	}
+	return tw.Flush()
+}
+
+// sweepOptions holds everything besides the source and target that shapes a sweep.
+type sweepOptions struct {
+	DryRun      bool
+	Rules       []sweepRule
+	Ignore      []ignorePattern
+	ArchiveRoot string
+	DateScheme  string
+	Folder      folderTemplate
+	FolderVars  templateVars
+	DateBasis   dateBasis
+	Collision   collisionPolicy
+	MinAge      time.Duration
+	AgeBasis    ageBasis
+	Only        []string
+	Duplicates  duplicatePolicy
+	Hashes      *hashIndex
+	Now         time.Time
+}
+
+// sweepFiles moves the entries of sourcePath into targetPath, or wherever a
+// matching rule sends them. With DryRun set nothing is touched and the returned
+// plan reports what a real sweep would do.
+func sweepFiles(fsys fs.FS, sourcePath, targetPath string, opts sweepOptions) (sweepPlan, error) {
+	plan, err := planSweep(fsys, sourcePath, targetPath, opts)
+	if err != nil {
+		return plan, err
+	}
+	if opts.DryRun {
+		slog.Info("Sweep preview completed.", slog.Int("plannedMoveCount", plan.count(actionMove)), slog.Int("plannedDeleteCount", plan.count(actionDelete)), slog.Int("plannedTrashCount", plan.count(actionTrash)), slog.Int("skippedFileCount", plan.count(actionSkip)-plan.countSkipped(skipReasonTooNew)), slog.Int("tooNewFileCount", plan.countSkipped(skipReasonTooNew)))
+		return plan, nil
+	}
+
+	moveCount := 0
+	deleteCount := 0
+	trashCount := 0
+	errorCount := 0
+	duplicateCount := 0
+	var duplicateBytes, reclaimedBytes int64
+	targetExists := map[string]bool{}
+
+	for i, m := range plan {
+		if m.DuplicateOf != "" {
+			duplicateCount++
+			duplicateBytes += m.Size
+		}
+		if m.Collision != "" {
+			slog.Info("Destination already exists.", slog.String("file", m.Source), slog.String("destination", m.Destination), slog.String("policy", string(m.Collision)), slog.String("action", string(m.Action)))
+		}
+
+		switch m.Action {
+		case actionMove:
+			dir := path.Dir(m.Destination)
+			if !targetExists[dir] {
+				// Determine if parent path needs created and only create if there is a file/folder to write
+				err = createTargetDirectory(dir)
+				if err != nil {
+					slog.Error("Unable to create target directory. ", slog.Any("error", err))
+					// If we cannot create the containing folder then fail fast
+					return plan, err
+				}
+				targetExists[dir] = true
+			}
+			if m.Collision == collisionOverwrite || m.Collision == collisionNewer {
+				err = removeForOverwrite(m.Destination)
+				if err != nil {
+					break
+				}
+			}
+			if m.DuplicateOf != "" && opts.Duplicates == duplicateHardLink {
+				var linked bool
+				if linked, err = linkDuplicate(m.Source, m.Destination, m.DuplicateOf); linked {
+					reclaimedBytes += m.Size
+				}
+				break
+			}
+			err = moveFile(m.Source, m.Destination)
+			plan[i].SourceKept = errors.Is(err, errSourceKept)
+		case actionDelete:
+			err = os.RemoveAll(m.Source)
+		case actionTrash:
+			plan[i].Destination, err = trashFile(m.Source, opts.Now)
+		default:
+			continue
+		}
+
+		if err != nil {
+			errorCount++
+			plan[i].Error = err.Error()
+			slog.Warn("Failed to sweep file.", slog.Any("error", err), slog.String("file", m.Source), slog.String("action", string(m.Action)))
+			if !plan[i].SourceKept {
+				continue
+			}
+		}
+		if m.Action == actionDelete {
+			deleteCount++
+		} else if m.Action == actionTrash {
+			trashCount++
+		} else {
+			moveCount++
+			if opts.Hashes != nil && m.Hash != "" {
+				if info, err := os.Lstat(m.Destination); err == nil {
+					opts.Hashes.add(m.Destination, hashedFile{Hash: m.Hash, Size: m.Size, ModTime: info.ModTime()})
+				}
+			}
+		}
+	}
+	slog.Info("Sweep completed.", slog.Int("sweptFileCount", moveCount), slog.Int("deletedFileCount", deleteCount), slog.Int("trashedFileCount", trashCount), slog.Int("skippedFileCount", plan.count(actionSkip)-plan.countSkipped(skipReasonTooNew)), slog.Int("tooNewFileCount", plan.countSkipped(skipReasonTooNew)), slog.Int("fileErrorCount", errorCount), slog.Int("duplicateFileCount", duplicateCount), slog.Int64("duplicateBytes", duplicateBytes), slog.Int64("reclaimedBytes", reclaimedBytes))
+	return plan, nil
+}
+
+// planSweep walks the source and decides what to do with each top level entry.
+// Directories are moved as a whole so the walk never descends into them.
+func planSweep(fsys fs.FS, sourcePath, targetPath string, opts sweepOptions) (sweepPlan, error) {
+	plan := sweepPlan{}
+	planned := map[string]bool{}
+	taken := func(p string) bool { return planned[p] || exists(p) }
+	// Content hashes of the files this plan moves, to catch duplicates within one sweep
+	seen := map[string]string{}
+
+	only := map[string]bool{}
+	for _, name := range opts.Only {
+		only[name] = true
+	}
+
+	ignoreFile, err := readIgnoreFile(fsys)
+	if err != nil {
+		slog.Warn("Unable to read ignore file.", slog.Any("error", err), slog.String("file", path.Join(sourcePath, ignoreFileName)))
+	}
+
+	err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+		if len(only) > 0 && !only[p] {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		m := plannedMove{Source: path.Join(sourcePath, p)}
+		ignoredBy, ignored := matchIgnore(p, d.IsDir(), opts.Ignore, ignoreFile)
+		switch {
+		case !d.Type().IsRegular() && !d.Type().IsDir():
+			m.Action = actionSkip
+			m.SkipReason = "not a regular file or folder"
+		case strings.HasPrefix(d.Name(), "."):
+			m.Action = actionSkip
+			m.SkipReason = "dot file"
+		case ignored:
+			m.Action = actionSkip
+			m.SkipReason = skipReasonIgnored
+			m.IgnoredBy = ignoredBy.String()
+		case opts.MinAge > 0 && isTooNew(d, opts):
+			m.Action = actionSkip
+			m.SkipReason = skipReasonTooNew
+		default:
+			m.Action = actionMove
+			m.Destination = path.Join(targetPath, p)
+			dated := opts.Now
+			if opts.FolderVars.FileDates || opts.Folder.perFile(false) {
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				fileTime := info.ModTime()
+				if opts.FolderVars.FileDates {
+					fileTime = fileDate(fsys, m.Source, p, info, opts.DateBasis)
+					dated = fileTime
+				}
+				m.Destination = path.Join(opts.ArchiveRoot, opts.Folder.expand(opts.FolderVars.withFile(d.Name(), info, fileTime)), p)
+			}
+
+			rule, ok, err := matchRule(fsys, p, d, opts)
+			if err != nil {
+				return err
+			}
+			if ok {
+				m.Rule = rule.Text
+				m.Action = rule.Action
+				switch rule.Action {
+				case actionMove:
+					m.Destination = path.Join(rule.destinationFor(opts.ArchiveRoot, opts.DateScheme, dated), p)
+				case actionSkip:
+					m.Destination = ""
+					m.SkipReason = "rule"
+				default:
+					m.Destination = ""
+					if info, err := d.Info(); err == nil && rule.waiting(info, opts.Now) {
+						m.Action = actionSkip
+						m.SkipReason = skipReasonWaitDelete
+						if rule.Action == actionTrash {
+							m.SkipReason = skipReasonWaitTrash
+						}
+					}
+				}
+			}
+
+			if m.Action == actionMove && opts.Hashes != nil && d.Type().IsRegular() {
+				if err := findDuplicate(fsys, p, d, &m, opts, seen); err != nil {
+					slog.Warn("Unable to check file for duplicates.", slog.Any("error", err), slog.String("file", m.Source))
+				}
+			}
+			if m.Action == actionMove && taken(m.Destination) {
+				if err := resolveCollision(&m, opts.Collision, opts.Now, taken); err != nil {
+					return err
+				}
+			}
+			if m.Action == actionMove {
+				planned[m.Destination] = true
+				if m.Hash != "" && m.DuplicateOf == "" {
+					seen[m.Hash] = m.Destination
+				}
+			}
+		}
+		plan = append(plan, m)
+
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	return plan, err
+}
+
+// isTooNew reports whether the entry is younger than the minimum age. Entries
+// that can no longer be read are treated as new so they are left alone.
+func isTooNew(d fs.DirEntry, opts sweepOptions) bool {
+	info, err := d.Info()
+	if err != nil {
+		return true
+	}
+	return opts.Now.Sub(ageStamp(info, opts.AgeBasis)) < opts.MinAge
+}
+
+// ageStamp returns the time the age of an entry is measured from.
+func ageStamp(info fs.FileInfo, basis ageBasis) time.Time {
+	if basis == ageBasisChanged {
+		return changeTime(info)
+	}
+	return info.ModTime()
+}
+
+// matchRule returns the first rule, in order, that matches the entry.
+func matchRule(fsys fs.FS, p string, d fs.DirEntry, opts sweepOptions) (sweepRule, bool, error) {
+	if len(opts.Rules) == 0 {
+		return sweepRule{}, false, nil
+	}
+	info, err := d.Info()
+	if err != nil {
+		return sweepRule{}, false, err
+	}
+
+	mime := ""
+	subject := ruleSubject{name: d.Name(), info: info, mime: func() string {
+		if mime == "" {
+			mime = sniffMIME(fsys, p, d)
+		}
+		return mime
+	}}
+	for _, r := range opts.Rules {
+		if r.matches(subject, opts.Now) {
+			return r, true, nil
+		}
+	}
+	return sweepRule{}, false, nil
+}
+
+// sniffMIME detects the MIME type of a file from its first bytes.
+func sniffMIME(fsys fs.FS, p string, d fs.DirEntry) string {
+	if d.IsDir() {
+		return "inode/directory"
+	}
+	f, err := fsys.Open(p)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	mime, _, _ := strings.Cut(http.DetectContentType(buf[:n]), ";")
+	return mime
+}
+
+// removeForOverwrite clears a destination folder so the source can take its place.
+// Files are left for os.Rename, which replaces them atomically.
+func removeForOverwrite(p string) error {
+	info, err := os.Lstat(p)
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+	return os.RemoveAll(p)
+}
+
+func createTargetDirectory(targetPath string) error {
+	if _, err := os.Stat(targetPath); errors.Is(err, os.ErrNotExist) {
+		err := os.MkdirAll(targetPath, os.ModePerm)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/adrg/xdg"
+)
+
+const (
+	daemonUnitName    string = "deskclean.service"
+	trayUnitName      string = "deskclean-tray.service"
+	sweepUnitName     string = "deskclean-sweep.service"
+	sweepTimerName    string = "deskclean-sweep.timer"
+	defaultOnCalendar string = "hourly"
+)
+
+// systemdUnit is a unit file for the systemd user instance.
+type systemdUnit struct {
+	Name     string
+	Contents string
+}
+
+func getUnitDir() string {
+	return path.Join(xdg.ConfigHome, "systemd", "user")
+}
+
+// execSpecifiers doubles the characters systemd would expand as specifiers
+// or environment variables on an Exec line.
+var execSpecifiers = strings.NewReplacer("%", "%%", "$", "$$")
+
+// execLine quotes the executable and its arguments for an Exec line.
+func execLine(exe string, args ...string) string {
+	parts := []string{}
+	for _, a := range append([]string{exe}, args...) {
+		if strings.ContainsAny(a, " \t\"'\\$%") {
+			a = strconv.Quote(execSpecifiers.Replace(a))
+		}
+		parts = append(parts, a)
+	}
+	return strings.Join(parts, " ")
+}
+
+// daemonUnits returns a service running the scheduler in the background or,
+// when onCalendar is set, a timer that sweeps every profile at those times.
+func daemonUnits(exe, appName, onCalendar string) []systemdUnit {
+	if onCalendar == "" {
+		return []systemdUnit{{Name: daemonUnitName, Contents: fmt.Sprintf(`[Unit]
+Description=%[1]s desktop sweeper
+
+[Service]
+ExecStart=%[2]s
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+
+[Install]
+WantedBy=default.target
+`, appName, execLine(exe, "daemon"))}}
+	}
+
+	return []systemdUnit{
+		{Name: sweepUnitName, Contents: fmt.Sprintf(`[Unit]
+Description=%[1]s sweep of every profile
+
+[Service]
+Type=oneshot
+ExecStart=%[2]s
+`, appName, execLine(exe, "sweep"))},
+		{Name: sweepTimerName, Contents: fmt.Sprintf(`[Unit]
+Description=%[1]s scheduled sweep
+
+[Timer]
+OnCalendar=%[2]s
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`, appName, onCalendar)},
+	}
+}
+
+// trayUnit starts the tray app with the graphical session.
+func trayUnit(exe, appName string) systemdUnit {
+	return systemdUnit{Name: trayUnitName, Contents: fmt.Sprintf(`[Unit]
+Description=%[1]s tray app
+PartOf=graphical-session.target
+After=graphical-session.target
+
+[Service]
+ExecStart=%[2]s
+Restart=on-failure
+
+[Install]
+WantedBy=graphical-session.target
+`, appName, execLine(exe))}
+}
+
+// installUnits writes the units to the user unit folder and enables the one
+// called enable, starting it straight away when now is set.
+func installUnits(units []systemdUnit, enable string, now bool) error {
+	dir := getUnitDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, u := range units {
+		if err := os.WriteFile(path.Join(dir, u.Name), []byte(u.Contents), 0644); err != nil {
+			return err
+		}
+		slog.Info("Wrote systemd unit.", slog.String("unit", u.Name), slog.String("dir", dir))
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if now {
+		return systemctl("enable", "--now", enable)
+	}
+	return systemctl("enable", enable)
+}
+
+// uninstallUnits disables the named units, stopping them as well when stop is
+// set, and removes their files. Units that were never installed are passed over.
+func uninstallUnits(stop bool, names ...string) error {
+	dir := getUnitDir()
+	removed := false
+	for _, name := range names {
+		file := path.Join(dir, name)
+		if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		args := []string{"disable", name}
+		if stop {
+			args = []string{"disable", "--now", name}
+		}
+		if err := systemctl(args...); err != nil {
+			slog.Warn("Unable to disable systemd unit.", slog.Any("error", err), slog.String("unit", name))
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		removed = true
+		slog.Info("Removed systemd unit.", slog.String("unit", name))
+	}
+	if !removed {
+		return nil
+	}
+	return systemctl("daemon-reload")
+}
+
+func unitEnabled(name string) bool {
+	return exec.Command("systemctl", "--user", "is-enabled", "--quiet", name).Run() == nil
+}
+
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", append([]string{"--user"}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl --user %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
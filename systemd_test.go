@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestExecLine(t *testing.T) {
+	tests := []struct {
+		exe  string
+		args []string
+		want string
+	}{
+		{"/usr/bin/DeskClean", []string{"daemon"}, "/usr/bin/DeskClean daemon"},
+		{"/opt/Desk Clean/DeskClean", []string{"sweep", "-all"}, `"/opt/Desk Clean/DeskClean" sweep -all`},
+		{"/home/a/100%/DeskClean", nil, `"/home/a/100%%/DeskClean"`},
+		{"/home/a/$HOME/DeskClean", nil, `"/home/a/$$HOME/DeskClean"`},
+		{"/usr/bin/DeskClean", []string{`say "hi"`}, `/usr/bin/DeskClean "say \"hi\""`},
+	}
+	for _, tt := range tests {
+		if got := execLine(tt.exe, tt.args...); got != tt.want {
+			t.Errorf("execLine(%q, %q) = %s, want %s", tt.exe, tt.args, got, tt.want)
+		}
+	}
+}
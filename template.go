@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// defaultFolderTemplate names archive folders the way sweeps always have,
+// "2026-10-16-Archive" for the default profile.
+const defaultFolderTemplate string = "{date}{sep}{label}"
+
+// templateFields lists the placeholders a folder template may use. Time fields
+// take an optional Go time layout after a colon, {month:Jan}, and use the
+// file's modification time instead of the sweep time with a file. prefix.
+var (
+	templateFields     = []string{"date", "year", "month", "day", "week", "weekyear", "label", "source", "hostname", "ext", "sep"}
+	templateTimeFields = map[string]string{"date": "", "year": "2006", "month": "01", "day": "02", "week": "", "weekyear": ""}
+)
+
+type templateToken struct {
+	Text   string
+	Field  string
+	Layout string
+	File   bool
+}
+
+// folderTemplate names the folder, possibly nested, that a sweep moves an item
+// into under the archive root.
+type folderTemplate struct {
+	Text     string
+	segments [][]templateToken
+}
+
+// templateVars are the values placeholders expand to. FileTime and Ext are only
+// set when expanding for a particular file. With FileDates set every time
+// placeholder uses the file's date, not just those with the file. prefix.
+type templateVars struct {
+	SweptAt    time.Time
+	FileTime   time.Time
+	FileDates  bool
+	Ext        string
+	DateScheme string
+	Label      string
+	Source     string
+	Hostname   string
+	Separator  string
+}
+
+func parseFolderTemplate(text string) (folderTemplate, error) {
+	t := folderTemplate{Text: text}
+	if strings.TrimSpace(text) == "" {
+		return t, errors.New("template is empty")
+	}
+	if path.IsAbs(text) {
+		return t, errors.New("template must be relative to the archive folder")
+	}
+	for _, segment := range splitTemplate(text) {
+		if segment == "" {
+			return t, errors.New("template has an empty folder name")
+		}
+		if segment == "." || segment == ".." {
+			return t, fmt.Errorf("template may not contain %q", segment)
+		}
+		tokens, err := parseTemplateSegment(segment)
+		if err != nil {
+			return t, err
+		}
+		t.segments = append(t.segments, tokens)
+	}
+	return t, nil
+}
+
+// splitTemplate splits the template into folder names at each "/" that is not
+// inside a placeholder.
+func splitTemplate(text string) []string {
+	segments := []string{}
+	start, inside := 0, false
+	for i, r := range text {
+		switch {
+		case r == '{':
+			inside = true
+		case r == '}':
+			inside = false
+		case r == '/' && !inside:
+			segments = append(segments, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(segments, text[start:])
+}
+
+func parseTemplateSegment(segment string) ([]templateToken, error) {
+	tokens := []templateToken{}
+	for segment != "" {
+		open := strings.IndexAny(segment, "{}")
+		if open < 0 {
+			tokens = append(tokens, templateToken{Text: segment})
+			break
+		}
+		if segment[open] == '}' {
+			return nil, errors.New(`unexpected "}" without a matching "{"`)
+		}
+		if open > 0 {
+			tokens = append(tokens, templateToken{Text: segment[:open]})
+		}
+		end := strings.IndexAny(segment[open+1:], "{}")
+		if end < 0 || segment[open+1+end] == '{' {
+			return nil, fmt.Errorf(`unclosed "{" in %q`, segment)
+		}
+		tok, err := parsePlaceholder(segment[open+1 : open+1+end])
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		segment = segment[open+end+2:]
+	}
+	return tokens, nil
+}
+
+func parsePlaceholder(text string) (templateToken, error) {
+	name, layout, hasLayout := strings.Cut(text, ":")
+	tok := templateToken{Layout: layout}
+	tok.Field, tok.File = strings.CutPrefix(name, "file.")
+
+	_, isTime := templateTimeFields[tok.Field]
+	switch {
+	case !isTime && !slices.Contains(templateFields, tok.Field):
+		return tok, fmt.Errorf("unknown placeholder {%s}, expected one of: %s", name, strings.Join(templateFields, ", "))
+	case tok.File && !isTime:
+		return tok, fmt.Errorf("{%s} is not a time, only times can be taken from the file", name)
+	case hasLayout && (!isTime || tok.Field == "week" || tok.Field == "weekyear"):
+		return tok, fmt.Errorf("{%s} does not take a format", name)
+	case hasLayout && layout == "":
+		return tok, fmt.Errorf("{%s} has an empty format", name)
+	case strings.Contains(layout, "/"):
+		return tok, fmt.Errorf("format of {%s} may not contain \"/\", use separate placeholders for nested folders", name)
+	}
+	return tok, nil
+}
+
+// perFile reports whether items of one sweep can land in different folders.
+func (t folderTemplate) perFile(fileDates bool) bool {
+	for _, segment := range t.segments {
+		if segmentPerFile(segment, fileDates) {
+			return true
+		}
+	}
+	return false
+}
+
+func segmentPerFile(segment []templateToken, fileDates bool) bool {
+	for _, tok := range segment {
+		_, isTime := templateTimeFields[tok.Field]
+		if tok.File || tok.Field == "ext" || fileDates && isTime {
+			return true
+		}
+	}
+	return false
+}
+
+// expand returns the folder for the values, relative to the archive root.
+// Folder names that expand to nothing are left out.
+func (t folderTemplate) expand(v templateVars) string {
+	return t.expandSegments(t.segments, v)
+}
+
+// base returns the leading folders that are the same for every item of a sweep.
+func (t folderTemplate) base(v templateVars) string {
+	n := 0
+	for n < len(t.segments) && !segmentPerFile(t.segments[n], v.FileDates) {
+		n++
+	}
+	return t.expandSegments(t.segments[:n], v)
+}
+
+func (t folderTemplate) expandSegments(segments [][]templateToken, v templateVars) string {
+	names := []string{}
+	for _, segment := range segments {
+		var b strings.Builder
+		for _, tok := range segment {
+			b.WriteString(tok.value(v))
+		}
+		name := b.String()
+		if name == "." || name == ".." {
+			name = strings.Repeat("_", len(name))
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return path.Join(names...)
+}
+
+func (tok templateToken) value(v templateVars) string {
+	if tok.Field == "" {
+		return tok.Text
+	}
+	t := v.SweptAt
+	if (tok.File || v.FileDates) && !v.FileTime.IsZero() {
+		t = v.FileTime
+	}
+
+	layout := tok.Layout
+	switch tok.Field {
+	case "date":
+		if layout == "" {
+			layout = v.DateScheme
+		}
+		if layout == "" {
+			layout = allowedDateFormats[0]
+		}
+	case "week":
+		_, week := t.ISOWeek()
+		return fmt.Sprintf("%02d", week)
+	case "weekyear":
+		year, _ := t.ISOWeek()
+		return fmt.Sprintf("%04d", year)
+	case "label":
+		return folderSafe(v.Label)
+	case "source":
+		return folderSafe(v.Source)
+	case "hostname":
+		return folderSafe(v.Hostname)
+	case "ext":
+		return folderSafe(v.Ext)
+	case "sep":
+		return folderSafe(v.Separator)
+	}
+	if layout == "" {
+		layout = templateTimeFields[tok.Field]
+	}
+	return folderSafe(t.Format(layout))
+}
+
+// folderSafe keeps a value from adding folders of its own.
+func folderSafe(s string) string {
+	return strings.ReplaceAll(s, "/", "-")
+}
+
+// withFile returns the values for expanding the template for one swept item
+// dated at fileTime. Folders have no extension.
+func (v templateVars) withFile(name string, info fs.FileInfo, fileTime time.Time) templateVars {
+	v.FileTime = fileTime
+	v.Ext = ""
+	if !info.IsDir() {
+		v.Ext = strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	}
+	return v
+}
+
+// folderTemplate returns the profile's archive folder template, or the default
+// when it has none.
+func (p sweepProfile) folderTemplate() (folderTemplate, error) {
+	if p.FolderTemplate == "" {
+		return parseFolderTemplate(defaultFolderTemplate)
+	}
+	t, err := parseFolderTemplate(p.FolderTemplate)
+	if err != nil {
+		return t, fmt.Errorf("invalid folder template for profile %s: %w", p.Name, err)
+	}
+	return t, nil
+}
+
+func getTemplateVars(pref fyne.Preferences, profile sweepProfile, now time.Time) templateVars {
+	hostname, _ := os.Hostname()
+	return templateVars{
+		SweptAt:    now,
+		FileDates:  profile.dateBasis() != dateBasisSweep,
+		DateScheme: profile.DateScheme,
+		Label:      profile.Label,
+		Source:     profile.Name,
+		Hostname:   hostname,
+		Separator:  pref.String("TargetFolderSeparator"),
+	}
+}
+
+// describeFolderTemplate shows where the profile would put an example file
+// swept at now, for display in settings.
+func describeFolderTemplate(pref fyne.Preferences, profile sweepProfile, now time.Time) (string, error) {
+	t, err := profile.folderTemplate()
+	if err != nil {
+		return "", err
+	}
+	v := getTemplateVars(pref, profile, now)
+	v.FileTime = now.AddDate(0, -1, -3)
+	v.Ext = "pdf"
+	dst := path.Join(getArchiveRoot(pref), t.expand(v), "report.pdf")
+	return fmt.Sprintf("report.pdf, dated %s, goes to %s", v.FileTime.Format("Jan 2"), dst), nil
+}
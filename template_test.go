@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParseFolderTemplateErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		err  string
+	}{
+		{"{date}{sep}{label}", ""},
+		{"{year}/{month:Jan}/{label}", ""},
+		{"{date:2006/01}", `may not contain "/"`},
+		{"{file.year}/{ext}", ""},
+		{"Plain folder", ""},
+		{"", "empty"},
+		{"   ", "empty"},
+		{"/abs/{date}", "relative"},
+		{"a//b", "empty folder name"},
+		{"a/", "empty folder name"},
+		{"../{date}", `may not contain ".."`},
+		{"a/./b", `may not contain "."`},
+		{"{date", "unclosed"},
+		{"{date{label}}", "unclosed"},
+		{"date}", "unexpected"},
+		{"{nope}", "unknown placeholder"},
+		{"{file.label}", "not a time"},
+		{"{label:x}", "does not take a format"},
+		{"{week:01}", "does not take a format"},
+		{"{month:}", "empty format"},
+	}
+	for _, tt := range tests {
+		_, err := parseFolderTemplate(tt.text)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("parseFolderTemplate(%q): %v", tt.text, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("parseFolderTemplate(%q) error = %v, want one containing %q", tt.text, err, tt.err)
+		}
+	}
+}
+
+func TestFolderTemplateExpand(t *testing.T) {
+	v := templateVars{
+		SweptAt:    time.Date(2026, time.October, 16, 9, 30, 0, 0, time.UTC),
+		FileTime:   time.Date(2025, time.December, 30, 12, 0, 0, 0, time.UTC),
+		Ext:        "pdf",
+		DateScheme: "2006-01-02",
+		Label:      "Archive",
+		Source:     "Desktop",
+		Hostname:   "host",
+		Separator:  "-",
+	}
+	tests := []struct {
+		text string
+		vars func(v templateVars) templateVars
+		want string
+	}{
+		{defaultFolderTemplate, nil, "2026-10-16-Archive"},
+		{"{year}/{month}/{day}", nil, "2026/10/16"},
+		{"{year}/{month:Jan}", nil, "2026/Oct"},
+		{"{date:2006-01}_{label}", nil, "2026-10_Archive"},
+		{"{file.year}/{file.month:January}", nil, "2025/December"},
+		// 30 December 2025 is in week 1 of 2026
+		{"{file.weekyear}-W{file.week}", nil, "2026-W01"},
+		{"{weekyear}-W{week}", nil, "2026-W42"},
+		{"{source}/{hostname}/{ext}", nil, "Desktop/host/pdf"},
+		{"{date}", func(v templateVars) templateVars { v.DateScheme = ""; return v }, "2026-10-16"},
+		{"{date}/{year}", func(v templateVars) templateVars { v.FileDates = true; return v }, "2025-12-30/2025"},
+		// Values never add folders of their own
+		{"{label}", func(v templateVars) templateVars { v.Label = "a/b"; return v }, "a-b"},
+		// Folders that expand to nothing are left out
+		{"{ext}/{label}", func(v templateVars) templateVars { v.Ext = ""; return v }, "Archive"},
+		{"{label}", func(v templateVars) templateVars { v.Label = ".."; return v }, "__"},
+	}
+	for _, tt := range tests {
+		ft, err := parseFolderTemplate(tt.text)
+		if err != nil {
+			t.Fatalf("parseFolderTemplate(%q): %v", tt.text, err)
+		}
+		vars := v
+		if tt.vars != nil {
+			vars = tt.vars(vars)
+		}
+		if got := ft.expand(vars); got != tt.want {
+			t.Errorf("expand(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFolderTemplateBase(t *testing.T) {
+	v := templateVars{SweptAt: time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC), Label: "Archive"}
+	tests := []struct {
+		text      string
+		fileDates bool
+		perFile   bool
+		base      string
+	}{
+		{"{year}/{label}", false, false, "2026/Archive"},
+		{"{year}/{ext}/{label}", false, true, "2026"},
+		{"{file.year}/{label}", false, true, ""},
+		{"{label}/{year}", true, true, "Archive"},
+		{"{label}/{source}", true, false, "Archive"},
+	}
+	for _, tt := range tests {
+		ft, err := parseFolderTemplate(tt.text)
+		if err != nil {
+			t.Fatalf("parseFolderTemplate(%q): %v", tt.text, err)
+		}
+		if got := ft.perFile(tt.fileDates); got != tt.perFile {
+			t.Errorf("perFile(%q, %v) = %v, want %v", tt.text, tt.fileDates, got, tt.perFile)
+		}
+		vars := v
+		vars.FileDates = tt.fileDates
+		if got := ft.base(vars); got != tt.base {
+			t.Errorf("base(%q) = %q, want %q", tt.text, got, tt.base)
+		}
+	}
+}
+
+func TestTemplateVarsWithFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Report.PDF": {},
+		"folder.d":   {Mode: fs.ModeDir | 0755},
+	}
+	stamp := time.Date(2026, time.January, 2, 0, 0, 0, 0, time.UTC)
+	for name, want := range map[string]string{"Report.PDF": "pdf", "folder.d": ""} {
+		info, err := fsys.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := templateVars{Ext: "old"}.withFile(name, info, stamp)
+		if v.Ext != want || !v.FileTime.Equal(stamp) {
+			t.Errorf("withFile(%q) = ext %q, time %v, want %q", name, v.Ext, v.FileTime, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+const (
+	trashInfoExt   string = ".trashinfo"
+	trashDateStamp string = "2006-01-02T15:04:05"
+)
+
+// trashFile moves p to the trash as described by the freedesktop.org Trash
+// specification and returns where it ended up. Items on the home filesystem
+// go to the home trash, items on other mounts to the trash at the top of that
+// mount, falling back to copying into the home trash when there is none.
+func trashFile(p string, now time.Time) (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		return "", errors.New("the trash action is not supported on Windows")
+	case "darwin":
+		// Finder keeps no metadata files, items are dropped straight in
+		dst := freeName(path.Join(xdg.Home, ".Trash", path.Base(p)), exists)
+		return dst, moveFile(p, dst)
+	}
+
+	dev, err := deviceOf(p)
+	if err != nil {
+		return "", err
+	}
+	home := path.Join(xdg.DataHome, "Trash")
+	if err := os.MkdirAll(home, 0700); err != nil {
+		return "", err
+	}
+	if homeDev, err := deviceOf(home); err == nil && homeDev == dev {
+		return trashInto(home, p, p, now)
+	}
+
+	top := mountTop(p, dev)
+	if dir, ok := topdirTrash(top); ok {
+		rel := strings.TrimPrefix(p, strings.TrimSuffix(top, "/")+"/")
+		dst, err := trashInto(dir, p, rel, now)
+		if err == nil {
+			return dst, nil
+		}
+		slog.Debug("Unable to use the trash of the mount, using the home trash.", slog.Any("error", err), slog.String("trash", dir))
+	}
+	return trashInto(home, p, p, now)
+}
+
+// mountTop returns the top directory of the mount p lives on.
+func mountTop(p string, dev uint64) string {
+	dir := path.Dir(p)
+	for dir != "/" {
+		parent := path.Dir(dir)
+		if d, err := deviceOf(parent); err != nil || d != dev {
+			return dir
+		}
+		dir = parent
+	}
+	return dir
+}
+
+// topdirTrash returns the trash of the current user at the top of a mount,
+// $topdir/.Trash/$uid when the administrator has set up a shared trash and
+// $topdir/.Trash-$uid otherwise.
+func topdirTrash(top string) (string, bool) {
+	uid := strconv.Itoa(os.Getuid())
+
+	// The shared trash must be a real, sticky directory so users cannot
+	// remove each others items
+	shared := path.Join(top, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&fs.ModeSticky != 0 {
+		dir := path.Join(shared, uid)
+		if err := os.Mkdir(dir, 0700); err == nil || errors.Is(err, fs.ErrExist) {
+			if info, err := os.Lstat(dir); err == nil && info.IsDir() {
+				return dir, true
+			}
+		}
+	}
+
+	dir := path.Join(top, ".Trash-"+uid)
+	if err := os.Mkdir(dir, 0700); err != nil && !errors.Is(err, fs.ErrExist) {
+		return "", false
+	}
+	if info, err := os.Lstat(dir); err != nil || !info.IsDir() {
+		return "", false
+	}
+	return dir, true
+}
+
+// trashInto moves p into the files folder of the trash dir. The info file is
+// claimed first so two trashers never pick the same name, and records original
+// as the original location.
+func trashInto(dir, p, original string, now time.Time) (string, error) {
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(path.Join(dir, sub), 0700); err != nil {
+			return "", err
+		}
+	}
+
+	name := path.Base(p)
+	for i := 1; ; i++ {
+		dst := path.Join(dir, "files", name)
+		info := path.Join(dir, "info", name+trashInfoExt)
+		f, err := os.OpenFile(info, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, fs.ErrExist) {
+			name = withSuffix(path.Base(p), fmt.Sprintf(" (%d)", i))
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if exists(dst) {
+			f.Close()
+			os.Remove(info)
+			name = withSuffix(path.Base(p), fmt.Sprintf(" (%d)", i))
+			continue
+		}
+
+		escaped := (&url.URL{Path: original}).EscapedPath()
+		_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", escaped, now.Format(trashDateStamp))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = moveFile(p, dst)
+		}
+		if err != nil {
+			os.Remove(info)
+			return "", err
+		}
+		return dst, nil
+	}
+}
+
+// removeTrashInfo drops the info file of an item taken back out of the trash.
+func removeTrashInfo(trashed string) error {
+	files := path.Dir(trashed)
+	if path.Base(files) != "files" {
+		return nil
+	}
+	err := os.Remove(path.Join(path.Dir(files), "info", path.Base(trashed)+trashInfoExt))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
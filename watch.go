@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	runOnChange string = "on change"
+
+	// watchSettleDelay is how long the source has to be quiet before changed
+	// entries are checked, and how often they are checked until they stop growing.
+	watchSettleDelay = 2 * time.Second
+	// watchFallbackInterval is how often a profile is swept when its source cannot be watched.
+	watchFallbackInterval = 15 * time.Minute
+)
+
+// entryState is what is compared to decide whether an entry has stopped changing.
+type entryState struct {
+	size    int64
+	modTime time.Time
+}
+
+// watchProfile sweeps the entries of the profile source as they are created or
+// changed, once they have stopped growing. Entries younger than the minimum age
+// of the profile wait until they are old enough. The returned error reports a
+// source that cannot be watched, for instance because the inotify watch limit
+// is hit.
+func watchProfile(p sweepProfile, stop chan bool, sweep func(sweepProfile, []string, sweepTrigger)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(p.SourcePath); err != nil {
+		watcher.Close()
+		return err
+	}
+	slog.Info("Watching sweep location for changes.", slog.String("profile", p.Name), slog.String("path", p.SourcePath))
+
+	go func() {
+		defer watcher.Close()
+		pending := map[string]bool{}
+		seen := map[string]entryState{}
+		waiting := map[string]time.Time{}
+		settle := time.NewTimer(watchSettleDelay)
+		settle.Stop()
+		aged := time.NewTimer(watchSettleDelay)
+		aged.Stop()
+		// waitForOldest sets aged to fire when the first waiting entry is old enough
+		waitForOldest := func() {
+			aged.Stop()
+			first := time.Time{}
+			for _, due := range waiting {
+				if first.IsZero() || due.Before(first) {
+					first = due
+				}
+			}
+			if !first.IsZero() {
+				aged.Reset(time.Until(first))
+			}
+		}
+
+		for {
+			select {
+			case <-stop:
+				settle.Stop()
+				aged.Stop()
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("Error watching sweep location.", slog.Any("error", err), slog.String("profile", p.Name))
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// Removes and renames away are what sweeping itself causes
+				if !e.Has(fsnotify.Create) && !e.Has(fsnotify.Write) && !e.Has(fsnotify.Chmod) {
+					continue
+				}
+				name := path.Base(e.Name)
+				pending[name] = true
+				delete(seen, name)
+				delete(waiting, name)
+				settle.Reset(watchSettleDelay)
+			case <-settle.C:
+				// An entry has settled once it looks the same on two checks in a row
+				settled := []string{}
+				for name := range pending {
+					state, err := statEntry(path.Join(p.SourcePath, name))
+					if err != nil {
+						delete(pending, name)
+						delete(seen, name)
+						continue
+					}
+					if prev, ok := seen[name]; ok && prev == state {
+						settled = append(settled, name)
+						delete(pending, name)
+						delete(seen, name)
+						continue
+					}
+					seen[name] = state
+				}
+				if len(pending) > 0 {
+					settle.Reset(watchSettleDelay)
+				}
+				ready := []string{}
+				for _, name := range settled {
+					if due := p.sweepableAt(name); due.After(time.Now()) {
+						waiting[name] = due
+						continue
+					}
+					ready = append(ready, name)
+				}
+				waitForOldest()
+				if len(ready) > 0 {
+					sweep(p, ready, triggerFileEvent)
+				}
+			case <-aged.C:
+				ready := []string{}
+				for name, due := range waiting {
+					if !due.After(time.Now()) {
+						ready = append(ready, name)
+						delete(waiting, name)
+					}
+				}
+				waitForOldest()
+				if len(ready) > 0 {
+					sweep(p, ready, triggerFileEvent)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// sweepableAt returns when the entry name of the profile source is old enough
+// to be swept, the zero time when it can be swept now.
+func (p sweepProfile) sweepableAt(name string) time.Time {
+	if p.minimumAge() <= 0 {
+		return time.Time{}
+	}
+	info, err := os.Lstat(path.Join(p.SourcePath, name))
+	if err != nil {
+		return time.Time{}
+	}
+	return ageStamp(info, ageBasis(p.MinimumAgeBasis)).Add(p.minimumAge())
+}
+
+// statEntry returns the total size and latest modification time of a file or
+// everything inside a folder.
+func statEntry(p string) (entryState, error) {
+	state := entryState{}
+	err := fs.WalkDir(os.DirFS(path.Dir(p)), path.Base(p), func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			state.size += info.Size()
+		}
+		if info.ModTime().After(state.modTime) {
+			state.modTime = info.ModTime()
+		}
+		return nil
+	})
+	return state, err
+}
+
+// isWatchLimit reports whether err means the system ran out of file watches.
+func isWatchLimit(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE)
+}
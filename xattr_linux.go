@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyXattrs copies the extended attributes of src onto dst without following symlinks.
+func copyXattrs(src, dst string) error {
+	size, err := unix.Llistxattr(src, nil)
+	if err != nil || size == 0 {
+		return err
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(src, buf)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+		n, err := unix.Lgetxattr(src, attr, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		value := make([]byte, n)
+		n, err = unix.Lgetxattr(src, attr, value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := unix.Lsetxattr(dst, attr, value[:n], 0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}